@@ -11,36 +11,238 @@ import (
 
 // Config 应用全局配置结构
 type Config struct {
-	Server  ServerConfig  `yaml:"server"`
-	Storage StorageConfig `yaml:"storage"`
-	Auth    AuthConfig    `yaml:"auth"`
-	Image   ImageConfig   `yaml:"image"`
+	Server    ServerConfig    `yaml:"server"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Metadata  MetadataConfig  `yaml:"metadata"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Image     ImageConfig     `yaml:"image"`
+	Tus       TusConfig       `yaml:"tus"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Quota     QuotaConfig     `yaml:"quota"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
 }
 
 // ServerConfig HTTP 服务器配置
 type ServerConfig struct {
-	Port string `yaml:"port"` // 监听端口
-	Host string `yaml:"host"` // 监听地址
+	Port           string   `yaml:"port"`            // 监听端口
+	Host           string   `yaml:"host"`            // 监听地址
+	TrustedProxies []string `yaml:"trusted_proxies"` // 信任的反向代理地址 (IP 或 CIDR)，只有来自这些地址的 X-Forwarded-For 才用于获取客户端 IP
 }
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Type     string `yaml:"type"`      // 存储类型: local, s3, oss 等
-	BasePath string `yaml:"base_path"` // 本地存储基础路径
-	BaseURL  string `yaml:"base_url"`  // 图片访问基础 URL
+	Type     string   `yaml:"type"`      // 存储类型: local, s3
+	BasePath string   `yaml:"base_path"` // 本地存储基础路径 (s3 模式下用于存放元数据)
+	BaseURL  string   `yaml:"base_url"`  // 图片访问基础 URL
+	S3       S3Config `yaml:"s3"`        // S3 兼容对象存储配置
+}
+
+// S3Config S3 兼容对象存储配置
+// 适用于 AWS S3、MinIO 以及其他兼容 S3 API 的服务商
+type S3Config struct {
+	Endpoint           string `yaml:"endpoint"`             // 服务地址，如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region             string `yaml:"region"`               // 区域，用于签名
+	Bucket             string `yaml:"bucket"`               // 存储桶名称
+	AccessKeyID        string `yaml:"access_key_id"`        // 访问密钥 ID
+	SecretAccessKey    string `yaml:"secret_access_key"`    // 访问密钥
+	PathStyle          bool   `yaml:"path_style"`           // 是否使用 path-style 寻址 (MinIO 通常需要开启)
+	Prefix             string `yaml:"prefix"`               // 对象键前缀，便于多个应用共用存储桶
+	PartSize           int64  `yaml:"part_size"`            // 分片上传的分片大小 (bytes)，超过此大小使用分片上传
+	RequestTimeoutSecs int    `yaml:"request_timeout_secs"` // 单个请求超时时间 (秒)
+}
+
+// MetadataConfig 元数据存储配置
+type MetadataConfig struct {
+	Type string `yaml:"type"` // 存储类型: json, sqlite
+	Path string `yaml:"path"` // 数据文件路径，为空时使用存储目录下的 metadata.json / metadata.db
 }
 
 // AuthConfig 鉴权配置
 type AuthConfig struct {
-	Enabled bool     `yaml:"enabled"` // 是否启用鉴权
-	Tokens  []string `yaml:"tokens"`  // 允许的 API Token 列表
+	Enabled  bool         `yaml:"enabled"`   // 是否启用鉴权
+	Tokens   []string     `yaml:"tokens"`    // 不属于任何用户的 API Token，拥有管理员权限 (兼容旧配置)
+	Users    []UserConfig `yaml:"users"`     // 用户账号
+	KeysFile string       `yaml:"keys_file"` // 通过接口创建的 API Key 保存位置
+}
+
+// UserConfig 用户账号配置
+// 用户只能查看和删除自己上传的图片，管理员不受限制
+type UserConfig struct {
+	Username     string       `yaml:"username"`      // 用户名，记录为图片的 owner_id
+	PasswordHash string       `yaml:"password_hash"` // bcrypt 密码哈希，可通过 -hash-password 生成；为空时不允许密码登录
+	Role         string       `yaml:"role"`          // 角色: admin / user
+	Tokens       []string     `yaml:"tokens"`        // 属于该用户的 API Token
+	Quota        *QuotaLimits `yaml:"quota"`         // 配额，未配置时使用 quota.default
+}
+
+// QuotaConfig 配额配置
+// 用户的配额在 auth.users 中配置，API Key 的配额在创建时指定
+type QuotaConfig struct {
+	UsageFile string      `yaml:"usage_file"` // 每日上传次数的保存位置
+	Default   QuotaLimits `yaml:"default"`    // 未单独配置配额的用户使用的配额
+}
+
+// QuotaLimits 配额，0 表示不限制
+type QuotaLimits struct {
+	MaxBytes         int64 `yaml:"max_bytes"`           // 占用的存储空间 (bytes)，包括缩略图与保存的原图
+	MaxImages        int64 `yaml:"max_images"`          // 图片数量
+	MaxUploadsPerDay int64 `yaml:"max_uploads_per_day"` // 每天的上传次数，命中重复图片同样计数
+}
+
+// RateLimitConfig 请求频率限制
+// 令牌桶算法，已鉴权的请求按 Token 计数，未启用鉴权时按客户端 IP 计数；鉴权失败按客户端 IP 单独计数
+type RateLimitConfig struct {
+	Enabled      bool          `yaml:"enabled"`       // 是否启用
+	Upload       RateLimitRule `yaml:"upload"`        // 上传接口 (包括批量上传、URL 上传与创建断点续传)
+	List         RateLimitRule `yaml:"list"`          // 图片列表
+	Delete       RateLimitRule `yaml:"delete"`        // 删除图片
+	AuthFailures RateLimitRule `yaml:"auth_failures"` // 鉴权失败 (全部 /api/v1 接口)，超出后该 IP 的请求不再校验凭据
+}
+
+// RateLimitRule 单类接口的频率限制
+type RateLimitRule struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"` // 每分钟补充的请求数，0 表示不限制
+	Burst             int     `yaml:"burst"`               // 允许的突发请求数 (令牌桶容量)，小于 1 时按 1 处理
 }
 
 // ImageConfig 图片处理配置
 type ImageConfig struct {
-	Quality      int      `yaml:"quality"`       // WebP 压缩质量 (1-100)
-	MaxSize      int64    `yaml:"max_size"`      // 最大上传文件大小 (bytes)
-	AllowedTypes []string `yaml:"allowed_types"` // 允许的 MIME 类型
+	Quality       int               `yaml:"quality"`        // WebP 压缩质量 (1-100)
+	MaxSize       int64             `yaml:"max_size"`       // 最大上传文件大小 (bytes)
+	MaxWidth      int               `yaml:"max_width"`      // 最大宽度 (像素)，0 表示不限制
+	MaxHeight     int               `yaml:"max_height"`     // 最大高度 (像素)，0 表示不限制
+	MaxMegapixels float64           `yaml:"max_megapixels"` // 最大像素数 (百万)，0 表示不限制
+	AllowedTypes  []string          `yaml:"allowed_types"`  // 允许的 MIME 类型
+	Format        string            `yaml:"format"`         // 默认输出格式: webp, avif (上传时可单独指定)
+	AVIF          AVIFConfig        `yaml:"avif"`           // AVIF 编码配置
+	Animation     AnimationConfig   `yaml:"animation"`      // 动图 (GIF / 动画 WebP) 配置
+	Exif          ExifConfig        `yaml:"exif"`           // EXIF 信息保留策略
+	Processing    ProcessingConfig  `yaml:"processing"`     // 处理并发限制
+	Batch         BatchConfig       `yaml:"batch"`          // 批量上传限制
+	Remote        RemoteConfig      `yaml:"remote"`         // 通过 URL 上传
+	Watermark     WatermarkConfig   `yaml:"watermark"`      // 水印配置 (上传时可单独覆盖)
+	Variants      VariantConfig     `yaml:"variants"`       // 动态缩放配置
+	Thumbnails    []ThumbnailConfig `yaml:"thumbnails"`     // 上传时生成的缩略图尺寸
+	Dedupe        bool              `yaml:"dedupe"`         // 相同内容重复上传时返回已有图片 (false 则总是新建)
+	KeepOriginal  bool              `yaml:"keep_original"`  // 是否另外保存上传的原图，便于日后重新处理
+	Private       PrivateConfig     `yaml:"private"`        // 私有图片的签名访问地址
+}
+
+// AVIFConfig AVIF 编码配置
+// 通过 libavif 的命令行工具编解码，未安装时 AVIF 不可用
+type AVIFConfig struct {
+	EncoderPath string `yaml:"encoder_path"` // avifenc 路径，不含路径分隔符时从 PATH 查找
+	DecoderPath string `yaml:"decoder_path"` // avifdec 路径，用于读取 AVIF 原图生成缩放变体
+	Quality     int    `yaml:"quality"`      // 压缩质量 (1-100)，AVIF 同等画质下通常可比 WebP 取更低的值
+	Speed       int    `yaml:"speed"`        // 编码速度 (0-10)，越小越慢、压缩率越高
+	TimeoutSecs int    `yaml:"timeout_secs"` // 单次编解码超时时间 (秒)
+}
+
+// AnimationConfig 动图配置
+// 动图保留全部帧与时长；GIF 转换为动画 WebP，动画 WebP 原样保存
+type AnimationConfig struct {
+	Enabled            bool    `yaml:"enabled"`              // 是否保留动画，false 时只保留第一帧
+	GIFOutput          string  `yaml:"gif_output"`           // GIF 的保存方式: webp (转换), gif (保留原文件), smaller (取两者中较小的)
+	MaxFrames          int     `yaml:"max_frames"`           // 最大帧数，超过时拒绝上传
+	MaxTotalMegapixels float64 `yaml:"max_total_megapixels"` // 全部帧的总像素数 (画布 × 帧数，百万)，0 表示不限制
+}
+
+// ExifConfig EXIF 信息配置
+// 处理后的图片本身不含 EXIF，此处只决定图片信息中保留哪些拍摄信息
+type ExifConfig struct {
+	Policy string `yaml:"policy"` // keep (全部保留), strip_gps (删除位置), strip_all (不保留)
+}
+
+// ProcessingConfig 图片处理并发配置
+// 上传处理与动态缩放共用同一个处理池，超过并发数的请求排队等待
+type ProcessingConfig struct {
+	Workers        int `yaml:"workers"`          // 同时处理的任务数，0 表示 CPU 核数
+	QueueSize      int `yaml:"queue_size"`       // 最大排队任务数，队列满时返回 503
+	RetryAfterSecs int `yaml:"retry_after_secs"` // 返回 503 时 Retry-After 头的秒数
+}
+
+// BatchConfig 批量上传配置
+// 一次请求中的文件并行处理，每个文件仍需占用处理池的槽位
+type BatchConfig struct {
+	MaxFiles    int `yaml:"max_files"`   // 单次请求最多文件数，<= 0 时使用默认值 20
+	Concurrency int `yaml:"concurrency"` // 单次请求同时处理的文件数
+}
+
+// RemoteConfig 通过 URL 上传配置
+// 服务端下载远程图片，默认禁止访问回环、私有等内网地址，防止 SSRF
+type RemoteConfig struct {
+	Enabled       bool     `yaml:"enabled"`        // 是否启用
+	TimeoutSecs   int      `yaml:"timeout_secs"`   // 下载超时时间 (秒)，包括连接、重定向与读取
+	MaxRedirects  int      `yaml:"max_redirects"`  // 最多跟随的重定向次数
+	MaxSize       int64    `yaml:"max_size"`       // 最大下载大小 (bytes)，0 表示使用 image.max_size
+	AllowNetworks []string `yaml:"allow_networks"` // 允许访问的内网地址段 (CIDR)，如 10.1.0.0/16
+}
+
+// PrivateConfig 私有图片配置
+// 私有图片不能通过 /images 访问，只能通过带有效期的 HMAC 签名地址访问
+type PrivateConfig struct {
+	SigningKey     string `yaml:"signing_key"`      // 签名密钥，为空时启动时随机生成 (重启后已签发的地址失效)
+	DefaultTTLSecs int    `yaml:"default_ttl_secs"` // 签名地址的默认有效期 (秒)
+	MaxTTLSecs     int    `yaml:"max_ttl_secs"`     // 签名地址的最长有效期 (秒)
+}
+
+// WatermarkConfig 水印配置
+// 在编码为输出格式前叠加到图片上，缩略图与缩放变体由加水印后的图片生成
+type WatermarkConfig struct {
+	Enabled   bool    `yaml:"enabled"`    // 是否默认添加水印，上传时可通过 watermark 字段开关
+	Text      string  `yaml:"text"`       // 文字水印内容
+	FontPath  string  `yaml:"font_path"`  // TTF / OTF / TTC 字体路径，留空使用内置 Go 字体 (不含中文字形)
+	Color     string  `yaml:"color"`      // 文字颜色，如 #ffffff
+	ImagePath string  `yaml:"image_path"` // PNG 水印图片路径，设置后优先于文字
+	Position  string  `yaml:"position"`   // 位置: top-left, top, top-right, left, center, right, bottom-left, bottom, bottom-right
+	Opacity   float64 `yaml:"opacity"`    // 不透明度 (0-1)
+	Scale     float64 `yaml:"scale"`      // 水印宽度占图片宽度的比例 (0-1)
+	MinWidth  int     `yaml:"min_width"`  // 宽度小于该值的图片不加水印
+	MinHeight int     `yaml:"min_height"` // 高度小于该值的图片不加水印
+}
+
+// ThumbnailConfig 缩略图尺寸配置
+type ThumbnailConfig struct {
+	Name    string `yaml:"name"`    // 尺寸名称，用作文件名后缀，如 small -> uuid_small.webp
+	Width   int    `yaml:"width"`   // 宽度，0 表示按高度等比缩放
+	Height  int    `yaml:"height"`  // 高度，0 表示按宽度等比缩放
+	Fit     string `yaml:"fit"`     // 缩放模式: cover, contain, fill，默认 cover
+	Quality int    `yaml:"quality"` // 压缩质量，0 表示使用 image.quality
+}
+
+// VariantConfig 动态缩放配置
+// 访问图片时可通过 ?w=&h=&fit=&q=&fmt= 参数生成变体，生成结果缓存在磁盘
+// 参数取值必须在允许列表内，防止恶意请求用任意组合填满缓存
+type VariantConfig struct {
+	Enabled   bool     `yaml:"enabled"`    // 是否启用
+	CachePath string   `yaml:"cache_path"` // 变体缓存目录，不要放在 storage.base_path 下
+	Widths    []int    `yaml:"widths"`     // 允许的宽度
+	Heights   []int    `yaml:"heights"`    // 允许的高度
+	Qualities []int    `yaml:"qualities"`  // 允许的质量
+	Formats   []string `yaml:"formats"`    // 允许的输出格式: webp, jpeg, png, avif
+
+	// 内容协商: 未指定 fmt 时根据 Accept 头选择客户端支持的格式
+	// 原图格式不被支持时依次尝试 AVIF、WebP，最后转为 FallbackFormat
+	Negotiate      bool   `yaml:"negotiate"`       // 是否启用
+	FallbackFormat string `yaml:"fallback_format"` // 兜底格式: jpeg, png
+}
+
+// TusConfig 断点续传 (tus 协议) 配置
+type TusConfig struct {
+	Enabled                bool   `yaml:"enabled"`                  // 是否启用
+	UploadDir              string `yaml:"upload_dir"`               // 未完成上传的临时目录
+	ExpirationMinutes      int    `yaml:"expiration_minutes"`       // 上传在最后一次写入后多久过期
+	CleanupIntervalMinutes int    `yaml:"cleanup_interval_minutes"` // 过期清理任务执行间隔
+}
+
+// JobsConfig 异步处理配置
+// 异步上传的原图与任务状态保存在 dir 中，服务重启后继续处理未完成的任务
+type JobsConfig struct {
+	Enabled        bool   `yaml:"enabled"`         // 是否启用异步上传
+	Dir            string `yaml:"dir"`             // 任务目录
+	Workers        int    `yaml:"workers"`         // 后台处理协程数
+	QueueSize      int    `yaml:"queue_size"`      // 最大等待任务数，超过时拒绝新的异步上传
+	RetentionHours int    `yaml:"retention_hours"` // 完成或失败的任务保留时长 (小时)
 }
 
 // DefaultConfig 返回默认配置
@@ -54,15 +256,110 @@ func DefaultConfig() *Config {
 			Type:     "local",
 			BasePath: "./storage/images",
 			BaseURL:  "/images",
+			S3: S3Config{
+				Region:             "us-east-1",
+				PartSize:           8 * 1024 * 1024, // 8MB
+				RequestTimeoutSecs: 60,
+			},
+		},
+		Metadata: MetadataConfig{
+			Type: "json",
 		},
 		Auth: AuthConfig{
-			Enabled: false,
-			Tokens:  []string{},
+			Enabled:  false,
+			Tokens:   []string{},
+			KeysFile: "./storage/api_keys.json",
 		},
 		Image: ImageConfig{
-			Quality:      75,
-			MaxSize:      10 * 1024 * 1024, // 10MB
-			AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			Quality:       75,
+			MaxSize:       10 * 1024 * 1024, // 10MB
+			MaxWidth:      16383,            // WebP 支持的最大尺寸
+			MaxHeight:     16383,
+			MaxMegapixels: 50,
+			AllowedTypes:  []string{"image/jpeg", "image/png", "image/webp", "image/gif"},
+			Format:        "webp",
+			Animation: AnimationConfig{
+				Enabled:            true,
+				GIFOutput:          "smaller",
+				MaxFrames:          300,
+				MaxTotalMegapixels: 100,
+			},
+			Exif: ExifConfig{
+				Policy: "strip_gps",
+			},
+			Processing: ProcessingConfig{
+				Workers:        0,
+				QueueSize:      64,
+				RetryAfterSecs: 5,
+			},
+			Batch: BatchConfig{
+				MaxFiles:    20,
+				Concurrency: 4,
+			},
+			Remote: RemoteConfig{
+				Enabled:      true,
+				TimeoutSecs:  15,
+				MaxRedirects: 3,
+			},
+			Watermark: WatermarkConfig{
+				Enabled:   false,
+				Color:     "#ffffff",
+				Position:  "bottom-right",
+				Opacity:   0.5,
+				Scale:     0.2,
+				MinWidth:  300,
+				MinHeight: 300,
+			},
+			AVIF: AVIFConfig{
+				EncoderPath: "avifenc",
+				DecoderPath: "avifdec",
+				Quality:     60,
+				Speed:       6,
+				TimeoutSecs: 60,
+			},
+			Variants: VariantConfig{
+				Enabled:   true,
+				CachePath: "./storage/cache",
+				Widths:    []int{100, 200, 400, 800, 1200},
+				Heights:   []int{100, 200, 400, 800, 1200},
+				Qualities: []int{50, 75, 90},
+				Formats:   []string{"webp", "jpeg", "png"},
+
+				Negotiate:      true,
+				FallbackFormat: "jpeg",
+			},
+			Thumbnails: []ThumbnailConfig{
+				{Name: "small", Width: 200, Height: 200, Fit: "cover"},
+			},
+			Dedupe:       true,
+			KeepOriginal: false,
+			Private: PrivateConfig{
+				DefaultTTLSecs: 3600,
+				MaxTTLSecs:     7 * 24 * 3600,
+			},
+		},
+		Tus: TusConfig{
+			Enabled:                true,
+			UploadDir:              "./storage/tus",
+			ExpirationMinutes:      24 * 60,
+			CleanupIntervalMinutes: 10,
+		},
+		Jobs: JobsConfig{
+			Enabled:        true,
+			Dir:            "./storage/jobs",
+			Workers:        2,
+			QueueSize:      1000,
+			RetentionHours: 24,
+		},
+		Quota: QuotaConfig{
+			UsageFile: "./storage/usage.json",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:      true,
+			Upload:       RateLimitRule{RequestsPerMinute: 60, Burst: 10},
+			List:         RateLimitRule{RequestsPerMinute: 300, Burst: 60},
+			Delete:       RateLimitRule{RequestsPerMinute: 120, Burst: 30},
+			AuthFailures: RateLimitRule{RequestsPerMinute: 10, Burst: 20},
 		},
 	}
 }
@@ -87,10 +384,9 @@ func Load(path string) (*Config, error) {
 	}
 
 	// 确保存储目录存在
-	if cfg.Storage.Type == "local" {
-		if err := os.MkdirAll(cfg.Storage.BasePath, 0755); err != nil {
-			return nil, err
-		}
+	// 非本地存储时元数据仍保存在此目录
+	if err := os.MkdirAll(cfg.Storage.BasePath, 0755); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
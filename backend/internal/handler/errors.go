@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+	"image-hosting/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorMapping 错误类别与 HTTP 状态码、业务错误码的对应关系
+type errorMapping struct {
+	target error
+	status int
+	code   int
+}
+
+// errorMappings 按顺序匹配，先匹配到的生效
+// 新增的服务错误需要在此登记，未登记的错误统一返回 500
+var errorMappings = []errorMapping{
+	{service.ErrInvalidFileType, http.StatusBadRequest, model.CodeInvalidFileType},
+	{service.ErrFileTooLarge, http.StatusRequestEntityTooLarge, model.CodeFileTooLarge},
+	{service.ErrImageTooLarge, http.StatusBadRequest, model.CodeImageTooLarge},
+	{service.ErrUnsupportedFormat, http.StatusBadRequest, model.CodeUnsupportedFormat},
+	{service.ErrTooManyFrames, http.StatusBadRequest, model.CodeTooManyFrames},
+	{service.ErrInvalidWatermark, http.StatusBadRequest, model.CodeBadRequest},
+	{service.ErrInvalidVisibility, http.StatusBadRequest, model.CodeBadRequest},
+	{service.ErrInvalidSignature, http.StatusForbidden, model.CodeForbidden},
+	{service.ErrImageNotFound, http.StatusNotFound, model.CodeNotFound},
+	{service.ErrOriginalNotFound, http.StatusNotFound, model.CodeNotFound},
+	{service.ErrVariantNotAllowed, http.StatusBadRequest, model.CodeVariantNotAllowed},
+	{service.ErrVariantDisabled, http.StatusBadRequest, model.CodeVariantDisabled},
+	{service.ErrServerBusy, http.StatusServiceUnavailable, model.CodeServerBusy},
+	{service.ErrTooManyFiles, http.StatusBadRequest, model.CodeTooManyFiles},
+	{service.ErrInvalidRemoteURL, http.StatusBadRequest, model.CodeBadRequest},
+	{service.ErrRemoteURLBlocked, http.StatusForbidden, model.CodeRemoteURLBlocked},
+	{service.ErrRemoteFetchFailed, http.StatusBadGateway, model.CodeRemoteFetchFailed},
+	{service.ErrQuotaExceeded, http.StatusForbidden, model.CodeQuotaExceeded},
+	{service.ErrUploadNotFound, http.StatusNotFound, model.CodeNotFound},
+	{service.ErrUploadTooLarge, http.StatusRequestEntityTooLarge, model.CodeFileTooLarge},
+	{service.ErrUploadOffsetMismatch, http.StatusConflict, model.CodeUploadConflict},
+	{service.ErrUploadCompleted, http.StatusConflict, model.CodeUploadConflict},
+	{service.ErrUploadLocked, http.StatusLocked, model.CodeUploadLocked},
+	{service.ErrJobNotFound, http.StatusNotFound, model.CodeNotFound},
+	{service.ErrAPIKeyNotFound, http.StatusNotFound, model.CodeNotFound},
+	{service.ErrInvalidAPIKey, http.StatusBadRequest, model.CodeBadRequest},
+	{service.ErrAPIKeysDisabled, http.StatusBadRequest, model.CodeBadRequest},
+	{service.ErrProcessingFailed, http.StatusInternalServerError, model.CodeProcessingFailed},
+	{service.ErrStorageFailed, http.StatusInternalServerError, model.CodeStorageFailed},
+	{storage.ErrNotExist, http.StatusNotFound, model.CodeNotFound},
+	{storage.ErrInvalidPath, http.StatusBadRequest, model.CodeBadRequest},
+}
+
+// classifyError 将服务层错误转换为 HTTP 状态码、业务错误码与错误详情
+func classifyError(err error) (int, int, map[string]interface{}) {
+	status, code := http.StatusInternalServerError, model.CodeInternalError
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			status, code = m.status, m.code
+			break
+		}
+	}
+
+	return status, code, errorDetails(err)
+}
+
+// ErrorCode 返回错误对应的业务错误码
+// 异步任务失败时记录该错误码，与同步上传的错误响应一致
+func ErrorCode(err error) int {
+	_, code, _ := classifyError(err)
+	return code
+}
+
+// errorDetails 从具体错误类型中提取详情
+func errorDetails(err error) map[string]interface{} {
+	var typeErr *service.InvalidFileTypeError
+	if errors.As(err, &typeErr) {
+		return map[string]interface{}{
+			"mime_type":     typeErr.MimeType,
+			"allowed_types": typeErr.AllowedTypes,
+		}
+	}
+
+	var sizeErr *service.FileTooLargeError
+	if errors.As(err, &sizeErr) {
+		return map[string]interface{}{
+			"size":     sizeErr.Size,
+			"max_size": sizeErr.MaxSize,
+		}
+	}
+
+	var dimErr *service.ImageTooLargeError
+	if errors.As(err, &dimErr) {
+		if dimErr.Frames > 0 {
+			return map[string]interface{}{
+				"width":                dimErr.Width,
+				"height":               dimErr.Height,
+				"frames":               dimErr.Frames,
+				"max_total_megapixels": dimErr.MaxTotalMegapixels,
+			}
+		}
+		return map[string]interface{}{
+			"width":          dimErr.Width,
+			"height":         dimErr.Height,
+			"max_width":      dimErr.MaxWidth,
+			"max_height":     dimErr.MaxHeight,
+			"max_megapixels": dimErr.MaxMegapixels,
+		}
+	}
+
+	var filesErr *service.TooManyFilesError
+	if errors.As(err, &filesErr) {
+		return map[string]interface{}{
+			"count":     filesErr.Count,
+			"max_files": filesErr.MaxFiles,
+		}
+	}
+
+	var quotaErr *service.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return map[string]interface{}{
+			"subject": quotaErr.Subject,
+			"limit":   quotaErr.Limit,
+			"used":    quotaErr.Used,
+			"max":     quotaErr.Max,
+		}
+	}
+
+	var fetchErr *service.RemoteFetchError
+	if errors.As(err, &fetchErr) && fetchErr.StatusCode != 0 {
+		return map[string]interface{}{
+			"status": fetchErr.StatusCode,
+		}
+	}
+
+	var variantErr *service.VariantNotAllowedError
+	if errors.As(err, &variantErr) {
+		return map[string]interface{}{
+			"param": variantErr.Param,
+			"value": variantErr.Value,
+		}
+	}
+
+	var busyErr *service.ServerBusyError
+	if errors.As(err, &busyErr) {
+		return map[string]interface{}{
+			"retry_after": int(busyErr.RetryAfter.Seconds()),
+		}
+	}
+
+	var storageErr *service.StorageError
+	if errors.As(err, &storageErr) {
+		return map[string]interface{}{
+			"op": storageErr.Op,
+		}
+	}
+
+	return nil
+}
+
+// respondError 按错误类别返回统一格式的错误响应
+// 处理队列已满时附带 Retry-After 头
+func respondError(c *gin.Context, err error) {
+	status, code, details := classifyError(err)
+
+	var busyErr *service.ServerBusyError
+	if errors.As(err, &busyErr) {
+		c.Header("Retry-After", strconv.Itoa(int(busyErr.RetryAfter.Seconds())))
+	}
+
+	c.JSON(status, model.NewErrorResponseWithDetails(code, errorMessage(c, err, code), details))
+}
+
+// errorMessage 返回给客户端的错误信息
+// 未登记的错误以及存储、处理失败可能包含文件路径等内部信息，只返回固定提示 (存储错误的操作类型见 details.op)，
+// 详情由 LoggerMiddleware 记录到日志
+func errorMessage(c *gin.Context, err error, code int) string {
+	message, masked := model.MaskedErrorMessage(code)
+	if !masked {
+		return err.Error()
+	}
+	c.Error(err)
+	return message
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/service"
+	"image-hosting/internal/storage"
+)
+
+// newTestConfig 返回数据全部保存在临时目录中的默认配置
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Storage.BasePath = filepath.Join(dir, "images")
+	cfg.Image.Variants.CachePath = filepath.Join(dir, "cache")
+	cfg.Image.Private.SigningKey = "test-signing-key"
+	cfg.Tus.UploadDir = filepath.Join(dir, "tus")
+	cfg.Jobs.Dir = filepath.Join(dir, "jobs")
+	cfg.Quota.UsageFile = filepath.Join(dir, "usage.json")
+	cfg.Auth.KeysFile = filepath.Join(dir, "api_keys.json")
+	return cfg
+}
+
+// newTestImageService 使用本地存储与 JSON 元数据创建图片服务
+func newTestImageService(t *testing.T, cfg *config.Config) (*service.ImageService, *service.AccountService) {
+	t.Helper()
+	store, err := storage.NewLocalStorage(cfg.Storage.BasePath, cfg.Storage.BaseURL)
+	if err != nil {
+		t.Fatalf("NewLocalStorage error: %v", err)
+	}
+	accounts, err := service.NewAccountService(&cfg.Auth, &cfg.Quota.Default)
+	if err != nil {
+		t.Fatalf("NewAccountService error: %v", err)
+	}
+	images, err := service.NewImageService(cfg, store, accounts)
+	if err != nil {
+		t.Fatalf("NewImageService error: %v", err)
+	}
+	t.Cleanup(func() { images.Close() })
+	return images, accounts
+}
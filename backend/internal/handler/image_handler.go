@@ -3,86 +3,384 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"image-hosting/internal/middleware"
 	"image-hosting/internal/model"
 	"image-hosting/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // ImageHandler 图片相关 HTTP 处理器
 type ImageHandler struct {
 	imageService *service.ImageService
+	jobs         *service.JobService // 为 nil 时不支持异步上传
 }
 
 // NewImageHandler 创建图片处理器
-func NewImageHandler(imageService *service.ImageService) *ImageHandler {
+func NewImageHandler(imageService *service.ImageService, jobs *service.JobService) *ImageHandler {
 	return &ImageHandler{
 		imageService: imageService,
+		jobs:         jobs,
 	}
 }
 
 // Upload 处理图片上传请求
 // POST /api/v1/upload
 // Content-Type: multipart/form-data
-// 表单字段: file (图片文件)
+// 表单字段: file (图片文件), format (可选，输出格式: webp / avif),
+// watermark / watermark_text / watermark_position / watermark_opacity / watermark_scale (可选，覆盖水印配置),
+// visibility (可选，public / private，私有图片只能通过签名地址访问),
+// async (可选，true 时保存原图后立即返回 202 与任务，通过 GET /api/v1/jobs/:id 查询结果)
 func (h *ImageHandler) Upload(c *gin.Context) {
+	limitBody(c, h.imageService.MaxSize()+formOverhead)
+
 	// 获取上传的文件
-	file, header, err := c.Request.FormFile("file")
+	header, err := c.FormFile("file")
+	if err != nil {
+		respondFormError(c, err, h.imageService.MaxSize())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		respondFormError(c, err, h.imageService.MaxSize())
+		return
+	}
+	defer file.Close()
+
+	watermark, err := service.ParseWatermarkOptions(c.PostForm)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opts := service.UploadOptions{
+		Format:     c.PostForm("format"),
+		Watermark:  watermark,
+		OwnerID:    ownerID(c),
+		KeyID:      keyID(c),
+		Visibility: c.PostForm("visibility"),
+	}
+
+	if async, _ := strconv.ParseBool(c.DefaultPostForm("async", c.Query("async"))); async {
+		h.submit(c, file, opts)
+		return
+	}
+
+	// 调用 service 处理上传
+	result, err := h.imageService.Upload(c.Request.Context(), file, header.Size, opts)
 	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(result))
+}
+
+// submit 创建异步处理任务
+func (h *ImageHandler) submit(c *gin.Context, file io.Reader, opts service.UploadOptions) {
+	if h.jobs == nil {
 		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
 			model.CodeBadRequest,
-			"failed to get uploaded file: "+err.Error(),
+			"async processing is disabled",
 		))
 		return
 	}
-	defer file.Close()
 
-	// 调用 service 处理上传
-	result, err := h.imageService.Upload(c.Request.Context(), file, header.Size)
-	if err != nil {
-		// 根据错误类型返回不同的错误码
-		code := model.CodeInternalError
-		status := http.StatusInternalServerError
-
-		errMsg := err.Error()
-		if contains(errMsg, "invalid file type") {
-			code = model.CodeInvalidFileType
-			status = http.StatusBadRequest
-		} else if contains(errMsg, "file too large") {
-			code = model.CodeFileTooLarge
-			status = http.StatusBadRequest
-		} else if contains(errMsg, "failed to process") {
-			code = model.CodeProcessingFailed
-			status = http.StatusInternalServerError
-		} else if contains(errMsg, "failed to save") {
-			code = model.CodeStorageFailed
-			status = http.StatusInternalServerError
+	job, err := h.jobs.Submit(c.Request.Context(), file, opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, model.NewSuccessResponse(job))
+}
+
+// UploadURL 下载远程图片并上传
+// POST /api/v1/upload/url
+// Content-Type: application/json 或表单
+// 字段: url (http / https 图片地址)，其余字段与单文件上传相同
+func (h *ImageHandler) UploadURL(c *gin.Context) {
+	limitBody(c, formOverhead)
+
+	get, err := requestValues(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"invalid request body: "+err.Error(),
+		))
+		return
+	}
+
+	rawURL := strings.TrimSpace(get("url"))
+	if rawURL == "" {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"url is required",
+		))
+		return
+	}
+
+	watermark, err := service.ParseWatermarkOptions(get)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	opts := service.UploadOptions{
+		Format:     get("format"),
+		Watermark:  watermark,
+		OwnerID:    ownerID(c),
+		KeyID:      keyID(c),
+		Visibility: get("visibility"),
+	}
+
+	asyncValue := get("async")
+	if asyncValue == "" {
+		asyncValue = c.Query("async")
+	}
+	if async, _ := strconv.ParseBool(asyncValue); async {
+		if h.jobs == nil {
+			c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+				model.CodeBadRequest,
+				"async processing is disabled",
+			))
+			return
+		}
+		if err := h.imageService.ValidateOptions(opts); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		// 下载在请求中完成，只有处理放到后台
+		body, source, err := h.imageService.FetchRemote(c.Request.Context(), rawURL)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
+		defer body.Close()
 
-		c.JSON(status, model.NewErrorResponse(code, errMsg))
+		opts.SourceURL = source
+		h.submit(c, body, opts)
+		return
+	}
+
+	result, err := h.imageService.UploadURL(c.Request.Context(), rawURL, opts)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, model.NewSuccessResponse(result))
 }
 
+// formOverhead 上传请求中文件以外部分 (表单字段、multipart 边界) 的大小上限
+const formOverhead = 1 << 20
+
+// limitBody 限制请求体大小
+// 超过时读取请求体返回 *http.MaxBytesError，不再继续接收
+func limitBody(c *gin.Context, n int64) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+}
+
+// respondFormError 表单解析失败时返回错误响应
+// 请求体超过大小限制时返回 413 与 file_too_large
+func respondFormError(c *gin.Context, err error, maxSize int64) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, model.NewErrorResponseWithDetails(
+			model.CodeFileTooLarge,
+			"request body too large",
+			map[string]interface{}{"max_size": maxSize},
+		))
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+		model.CodeBadRequest,
+		"failed to get uploaded file: "+err.Error(),
+	))
+}
+
+// requestValues 读取 JSON 请求体或表单中的字段
+// JSON 中的布尔值与数字转换为字符串，与表单字段按相同方式解析
+func requestValues(c *gin.Context) (func(key string) string, error) {
+	if c.ContentType() != binding.MIMEJSON {
+		return c.PostForm, nil
+	}
+
+	var body map[string]interface{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		return nil, err
+	}
+	return func(key string) string {
+		if v, ok := body[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}, nil
+}
+
+// BatchUpload 批量上传图片
+// POST /api/v1/upload/batch
+// Content-Type: multipart/form-data
+// 表单字段: files (可重复，每个文件一个字段)，其余字段与单文件上传相同，对所有文件生效
+// 文件数或参数无效时整个请求失败；否则返回每个文件的结果，单个文件失败不影响其他文件
+func (h *ImageHandler) BatchUpload(c *gin.Context) {
+	// 文件数在解析表单后检查，此处按最大文件数限制请求体大小
+	limitBody(c, int64(h.imageService.MaxBatchFiles())*h.imageService.MaxSize()+formOverhead)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		respondFormError(c, err, h.imageService.MaxSize())
+		return
+	}
+
+	headers := append(form.File["files"], form.File["file"]...)
+	if len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"no files uploaded",
+		))
+		return
+	}
+
+	watermark, err := service.ParseWatermarkOptions(c.PostForm)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	opts := service.UploadOptions{
+		Format:     c.PostForm("format"),
+		Watermark:  watermark,
+		OwnerID:    ownerID(c),
+		KeyID:      keyID(c),
+		Visibility: c.PostForm("visibility"),
+	}
+
+	files := make([]service.BatchFile, len(headers))
+	for i, fh := range headers {
+		fh := fh
+		files[i] = service.BatchFile{
+			Name: fh.Filename,
+			Size: fh.Size,
+			Open: func() (io.ReadCloser, error) { return fh.Open() },
+		}
+	}
+
+	if async, _ := strconv.ParseBool(c.DefaultPostForm("async", c.Query("async"))); async {
+		h.submitBatch(c, files, opts)
+		return
+	}
+
+	results, err := h.imageService.UploadBatch(c.Request.Context(), files, opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	batch := model.NewBatchUploadResult(len(files))
+	for i, r := range results {
+		item := newBatchItem(c, i, files[i].Name, r.Err)
+		item.Result = r.Result
+		batch.Add(item)
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(batch))
+}
+
+// submitBatch 为每个文件创建异步处理任务
+func (h *ImageHandler) submitBatch(c *gin.Context, files []service.BatchFile, opts service.UploadOptions) {
+	if h.jobs == nil {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"async processing is disabled",
+		))
+		return
+	}
+	if err := h.imageService.CheckBatch(len(files), opts); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	batch := model.NewBatchUploadResult(len(files))
+	for i, f := range files {
+		job, err := h.submitFile(c, f, opts)
+		item := newBatchItem(c, i, f.Name, err)
+		item.Job = job
+		batch.Add(item)
+	}
+
+	c.JSON(http.StatusAccepted, model.NewSuccessResponse(batch))
+}
+
+// submitFile 为单个文件创建异步任务
+func (h *ImageHandler) submitFile(c *gin.Context, f service.BatchFile, opts service.UploadOptions) (*model.Job, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return h.jobs.Submit(c.Request.Context(), file, opts)
+}
+
+// newBatchItem 生成单个文件的结果，错误码与单文件上传的错误响应一致
+func newBatchItem(c *gin.Context, index int, filename string, err error) model.BatchUploadItem {
+	item := model.BatchUploadItem{
+		Index:    index,
+		Filename: filename,
+		Code:     model.CodeSuccess,
+		Message:  "ok",
+	}
+	if err != nil {
+		_, code, details := classifyError(err)
+		item.Code = code
+		item.Message = errorMessage(c, err, code)
+		item.ErrorCode = model.ErrorCodeName(code)
+		item.Details = details
+	}
+	return item
+}
+
+// ownerID 上传图片的归属用户
+// 未启用鉴权或使用不属于用户的 Token 时为空
+func ownerID(c *gin.Context) string {
+	if user := middleware.CurrentUser(c); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// keyID 上传时使用的 API Key，用于统计 Key 的配额
+func keyID(c *gin.Context) string {
+	if user := middleware.CurrentUser(c); user != nil {
+		return user.KeyID
+	}
+	return ""
+}
+
 // List 获取图片列表
-// GET /api/v1/images?page=1&page_size=20
+// GET /api/v1/images?page=1&page_size=20&format=png
+// 普通用户只返回自己上传的图片，管理员返回全部
 func (h *ImageHandler) List(c *gin.Context) {
 	// 解析分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	format := c.Query("format")
 
 	// 调用 service 获取列表
-	result, err := h.imageService.ListImages(c.Request.Context(), page, pageSize)
+	result, err := h.imageService.ListImages(c.Request.Context(), middleware.CurrentUser(c), page, pageSize, format)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.NewErrorResponse(
-			model.CodeInternalError,
-			err.Error(),
-		))
+		respondError(c, err)
 		return
 	}
 
@@ -102,26 +400,36 @@ func (h *ImageHandler) Get(c *gin.Context) {
 	}
 
 	// 调用 service 获取图片
-	img, err := h.imageService.GetImage(c.Request.Context(), id)
+	img, err := h.imageService.ImageInfo(c.Request.Context(), middleware.CurrentUser(c), id)
 	if err != nil {
-		if contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, model.NewErrorResponse(
-				model.CodeNotFound,
-				err.Error(),
-			))
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, model.NewErrorResponse(
-			model.CodeInternalError,
-			err.Error(),
-		))
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, model.NewSuccessResponse(img))
 }
 
+// Original 下载上传时保存的原图
+// GET /api/v1/image/:id/original
+// 需启用 image.keep_original；原图不经过 /images 公开访问，受 API 鉴权保护
+func (h *ImageHandler) Original(c *gin.Context) {
+	img, filename, err := h.imageService.OpenOriginal(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer img.Reader.Close()
+
+	c.Header("Content-Type", img.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	if rs, ok := img.Reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", img.ModTime, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, img.Size, img.ContentType, img.Reader, nil)
+}
+
 // Delete 删除图片
 // DELETE /api/v1/image/:id
 func (h *ImageHandler) Delete(c *gin.Context) {
@@ -135,36 +443,57 @@ func (h *ImageHandler) Delete(c *gin.Context) {
 	}
 
 	// 调用 service 删除图片
-	err := h.imageService.DeleteImage(c.Request.Context(), id)
+	err := h.imageService.DeleteImage(c.Request.Context(), middleware.CurrentUser(c), id)
 	if err != nil {
-		if contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, model.NewErrorResponse(
-				model.CodeNotFound,
-				err.Error(),
-			))
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, model.NewErrorResponse(
-			model.CodeInternalError,
-			err.Error(),
-		))
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, model.NewSuccessResponse(nil))
 }
 
-// contains 检查字符串是否包含子串
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsImpl(s, substr))
+// Usage 查询配额用量
+// GET /api/v1/usage?username=alice
+// 默认查询当前用户，使用 API Key 访问时同时返回该 Key 的用量；管理员可通过 username 查询其他用户
+func (h *ImageHandler) Usage(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	username, keyID := ownerID(c), keyID(c)
+	if target := c.Query("username"); target != "" && target != username {
+		if user != nil && !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, model.NewErrorResponse(
+				model.CodeForbidden,
+				"only admin can query usage of other users",
+			))
+			return
+		}
+		username, keyID = target, ""
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(h.imageService.Usage(username, keyID)))
 }
 
-func containsImpl(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+// SignURL 生成私有图片的签名访问地址
+// GET /api/v1/image/:id/signed-url?expires_in=3600
+// expires_in 为有效期 (秒)，未指定时使用 image.private.default_ttl_secs，超过 max_ttl_secs 时按上限处理
+func (h *ImageHandler) SignURL(c *gin.Context) {
+	var ttl time.Duration
+	if v := c.Query("expires_in"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+				model.CodeBadRequest,
+				"invalid parameter expires_in: "+v,
+			))
+			return
 		}
+		ttl = time.Duration(secs) * time.Second
 	}
-	return false
+
+	signed, err := h.imageService.SignURL(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"), ttl)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(signed))
 }
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	"image-hosting/internal/middleware"
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobHandler 异步处理任务查询处理器
+type JobHandler struct {
+	jobs *service.JobService
+}
+
+// NewJobHandler 创建任务处理器
+func NewJobHandler(jobs *service.JobService) *JobHandler {
+	return &JobHandler{
+		jobs: jobs,
+	}
+}
+
+// Get 查询任务状态
+// GET /api/v1/jobs/:id
+// 处理完成后 result 与同步上传的返回结果相同，失败时 error 中为对应的错误码
+func (h *JobHandler) Get(c *gin.Context) {
+	job, err := h.jobs.Get(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(job))
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"image-hosting/internal/middleware"
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyHandler API Key 管理处理器
+// 需要 admin 权限
+type KeyHandler struct {
+	accounts *service.AccountService
+}
+
+// NewKeyHandler 创建 API Key 管理处理器
+func NewKeyHandler(accounts *service.AccountService) *KeyHandler {
+	return &KeyHandler{
+		accounts: accounts,
+	}
+}
+
+// createKeyRequest 创建 API Key 请求
+type createKeyRequest struct {
+	Name      string       `json:"name"`
+	Username  string       `json:"username"`   // 所属用户，为空时为当前用户
+	Scopes    []string     `json:"scopes"`     // upload / read / delete / admin
+	ExpiresAt *time.Time   `json:"expires_at"` // 过期时间 (RFC 3339)，为空表示不过期
+	Quota     *model.Quota `json:"quota"`      // 使用该 Key 上传的配额，为空表示不限制
+}
+
+// Create 创建 API Key
+// POST /api/v1/keys
+// Content-Type: application/json
+// 返回结果中的 key 只返回这一次，服务端只保存其哈希
+func (h *KeyHandler) Create(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"invalid request body: "+err.Error(),
+		))
+		return
+	}
+	if req.Username == "" {
+		if user := middleware.CurrentUser(c); user != nil {
+			req.Username = user.Username
+		}
+	}
+
+	key, err := h.accounts.CreateKey(c.Request.Context(), service.APIKeyOptions{
+		Name:      req.Name,
+		Username:  req.Username,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		Quota:     req.Quota,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(key))
+}
+
+// List 列出全部 API Key
+// GET /api/v1/keys
+func (h *KeyHandler) List(c *gin.Context) {
+	keys, err := h.accounts.ListKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(keys))
+}
+
+// Revoke 吊销 API Key
+// DELETE /api/v1/keys/:id
+func (h *KeyHandler) Revoke(c *gin.Context) {
+	key, err := h.accounts.RevokeKey(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(key))
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"net/http"
+
 	"image-hosting/internal/config"
 	"image-hosting/internal/middleware"
+	"image-hosting/internal/model"
 	"image-hosting/internal/service"
 	"image-hosting/internal/storage"
 
@@ -12,53 +15,148 @@ import (
 
 // SetupRouter 配置并返回 Gin 路由器
 // 集中管理所有路由和中间件配置
-func SetupRouter(cfg *config.Config, store storage.Storage, imageService *service.ImageService) *gin.Engine {
+// uploads 为 nil 时不注册断点续传接口，jobs 为 nil 时不注册任务查询接口
+func SetupRouter(cfg *config.Config, store storage.Storage, imageService *service.ImageService, uploads *service.ResumableUploadService, jobs *service.JobService, accounts *service.AccountService) *gin.Engine {
 	// 生产环境使用 release 模式
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
 
+	// 上传的文件超过 1MB 的部分写入临时文件，内存占用不随文件大小增长
+	r.MaxMultipartMemory = 1 << 20
+
 	// 全局中间件
 	r.Use(middleware.RecoveryMiddleware())
 	r.Use(middleware.LoggerMiddleware())
 
 	// CORS 配置 - 允许前端跨域访问
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"}, // 生产环境应限制为具体域名
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowOrigins: []string{"*"}, // 生产环境应限制为具体域名
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders: []string{
+			"Origin", "Content-Type", "Authorization",
+			// tus 断点续传请求头
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+		},
+		ExposeHeaders: []string{
+			"Content-Length",
+			// tus 断点续传响应头
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Expires", "X-Image-Id",
+			// 限流响应头
+			"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+		},
 		AllowCredentials: true,
 	}))
 
-	// 静态文件服务 - 提供图片访问
-	// 将 /images 路径映射到存储目录
-	if ls, ok := store.(*storage.LocalStorage); ok {
-		r.Static("/images", ls.GetBasePath())
-	}
-
 	// 创建 Handler
-	imageHandler := NewImageHandler(imageService)
+	imageHandler := NewImageHandler(imageService, jobs)
+	serveHandler := NewServeHandler(imageService)
+
+	// 图片访问 - 支持 ?w=&h=&fit=&q=&fmt= 动态缩放
+	// 本地存储时替代静态文件服务，对象存储时作为代理
+	r.GET("/images/*filepath", serveHandler.Serve)
+	r.HEAD("/images/*filepath", serveHandler.Serve)
+
+	// 私有图片 - 只能通过 /api/v1/image/:id/signed-url 生成的签名地址访问
+	r.GET(service.PrivateURLPrefix+"/*filepath", serveHandler.ServePrivate)
+	r.HEAD(service.PrivateURLPrefix+"/*filepath", serveHandler.ServePrivate)
+
+	// 断点续传 (tus 1.0)
+	// OPTIONS 供客户端查询服务端能力，tus 客户端不会为其携带凭据，在鉴权之外注册
+	var tusHandler *TusHandler
+	if uploads != nil {
+		tusHandler = NewTusHandler(uploads)
+		r.OPTIONS("/api/v1/tus", TusResumableMiddleware(), tusHandler.Options)
+	}
 
 	// API 路由组
 	api := r.Group("/api/v1")
 	{
-		// 应用鉴权中间件
-		api.Use(middleware.AuthMiddleware(&cfg.Auth))
+		// 按接口类别限流，每类接口各自计数；鉴权失败按 IP 计数，在校验凭据前检查
+		var uploadLimiter, listLimiter, deleteLimiter, authLimiter *middleware.RateLimiter
+		if cfg.RateLimit.Enabled {
+			uploadLimiter = middleware.NewRateLimiter(cfg.RateLimit.Upload)
+			listLimiter = middleware.NewRateLimiter(cfg.RateLimit.List)
+			deleteLimiter = middleware.NewRateLimiter(cfg.RateLimit.Delete)
+			authLimiter = middleware.NewRateLimiter(cfg.RateLimit.AuthFailures)
+		}
+		api.Use(middleware.AuthFailureLimitMiddleware(authLimiter))
+
+		// 应用鉴权中间件，普通用户只能访问自己上传的图片
+		// 每个接口要求对应的权限范围，API Key 只能访问创建时指定的范围
+		api.Use(middleware.AuthMiddleware(&cfg.Auth, accounts))
+		upload := middleware.RequireScope(model.ScopeUpload)
+		read := middleware.RequireScope(model.ScopeRead)
+		del := middleware.RequireScope(model.ScopeDelete)
+
+		uploadLimit := middleware.RateLimitMiddleware(uploadLimiter)
+		listLimit := middleware.RateLimitMiddleware(listLimiter)
+		deleteLimit := middleware.RateLimitMiddleware(deleteLimiter)
 
 		// 图片上传
-		api.POST("/upload", imageHandler.Upload)
+		api.POST("/upload", upload, uploadLimit, imageHandler.Upload)
+
+		// 批量上传
+		api.POST("/upload/batch", upload, uploadLimit, imageHandler.BatchUpload)
+
+		// 通过 URL 上传
+		if imageService.RemoteEnabled() {
+			api.POST("/upload/url", upload, uploadLimit, imageHandler.UploadURL)
+		}
 
 		// 图片列表
-		api.GET("/images", imageHandler.List)
+		api.GET("/images", read, listLimit, imageHandler.List)
 
 		// 单张图片信息
-		api.GET("/image/:id", imageHandler.Get)
+		api.GET("/image/:id", read, imageHandler.Get)
+
+		// 下载原图 (image.keep_original)
+		api.GET("/image/:id/original", read, imageHandler.Original)
+
+		// 生成私有图片的签名访问地址
+		api.GET("/image/:id/signed-url", read, imageHandler.SignURL)
 
 		// 删除图片
-		api.DELETE("/image/:id", imageHandler.Delete)
+		api.DELETE("/image/:id", del, deleteLimit, imageHandler.Delete)
+
+		// 配额用量
+		api.GET("/usage", read, imageHandler.Usage)
+
+		// 异步处理任务状态
+		if jobs != nil {
+			jobHandler := NewJobHandler(jobs)
+			api.GET("/jobs/:id", read, jobHandler.Get)
+		}
+
+		// 断点续传 (tus 1.0)
+		if tusHandler != nil {
+			tus := api.Group("/tus", upload, TusResumableMiddleware())
+			tus.POST("", uploadLimit, tusHandler.Create)
+			tus.HEAD("/:id", tusHandler.Head)
+			tus.PATCH("/:id", tusHandler.Patch)
+			tus.DELETE("/:id", tusHandler.Delete)
+			tus.GET("/:id", tusHandler.Result)
+		}
+
+		// API Key 管理 (auth.keys_file)
+		if accounts.KeysEnabled() {
+			keyHandler := NewKeyHandler(accounts)
+			keys := api.Group("/keys", middleware.RequireScope(model.ScopeAdmin))
+			keys.POST("", keyHandler.Create)
+			keys.GET("", keyHandler.List)
+			keys.DELETE("/:id", keyHandler.Revoke)
+		}
 	}
 
+	// 未匹配的路由同样返回统一格式的错误响应
+	r.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, model.NewErrorResponse(
+			model.CodeNotFound,
+			"route not found: "+c.Request.URL.Path,
+		))
+	})
+
 	// 健康检查接口 (不需要鉴权)
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"image-hosting/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter 创建启用鉴权与断点续传的完整路由
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	cfg := newTestConfig(t)
+	cfg.Auth.Enabled = true
+	cfg.Auth.Tokens = []string{"admin-token"}
+
+	images, accounts := newTestImageService(t, cfg)
+	uploads, err := service.NewResumableUploadService(&cfg.Tus, cfg.Image.MaxSize, images)
+	if err != nil {
+		t.Fatalf("NewResumableUploadService error: %v", err)
+	}
+	t.Cleanup(func() { uploads.Close() })
+
+	return SetupRouter(cfg, nil, images, uploads, nil, accounts)
+}
+
+// tus 客户端查询服务端能力时不携带凭据
+func TestRouterTusOptionsWithoutAuth(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/v1/tus", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("OPTIONS /api/v1/tus status = %d, want 204, body: %s", w.Code, w.Body.String())
+	}
+	for _, h := range []string{"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size"} {
+		if w.Header().Get(h) == "" {
+			t.Errorf("missing %s header", h)
+		}
+	}
+}
+
+// 除 OPTIONS 外的 tus 接口仍需鉴权
+func TestRouterTusRequiresAuth(t *testing.T) {
+	r := newTestRouter(t)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"未携带凭据", "", http.StatusUnauthorized},
+		{"错误的凭据", "wrong-token", http.StatusUnauthorized},
+		{"有效凭据", "admin-token", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tus", nil)
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Upload-Length", "100")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("POST /api/v1/tus status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+	"image-hosting/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServeHandler 图片访问处理器
+// 替代静态文件服务，支持通过 URL 参数动态缩放
+type ServeHandler struct {
+	images   *service.ImageService
+	variants *service.VariantService
+}
+
+// NewServeHandler 创建图片访问处理器
+func NewServeHandler(imageService *service.ImageService) *ServeHandler {
+	return &ServeHandler{
+		images:   imageService,
+		variants: imageService.Variants(),
+	}
+}
+
+// Serve 输出公开图片
+// GET /images/*filepath?w=400&h=300&fit=cover&q=75&fmt=webp
+// 不带参数时返回原图；未指定 fmt 时根据 Accept 头协商输出格式
+// 私有图片及其缩略图视为不存在，只能通过 ServePrivate 访问
+func (h *ServeHandler) Serve(c *gin.Context) {
+	storagePath := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	private, err := h.images.IsPrivatePath(c.Request.Context(), storagePath)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if private {
+		respondError(c, service.ErrImageNotFound)
+		return
+	}
+
+	h.serve(c, storagePath)
+}
+
+// ServePrivate 通过签名地址输出图片
+// GET /private/*filepath?expires=1700000000&sig=...&w=400
+// 地址由 GET /api/v1/image/:id/signed-url 生成，缩放参数与 Serve 相同，不参与签名
+func (h *ServeHandler) ServePrivate(c *gin.Context) {
+	storagePath := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	expires := c.Query("expires")
+	if err := h.images.Signer().Verify(storagePath, expires, c.Query("sig")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 只允许浏览器在签名有效期内缓存，不允许 CDN 等共享缓存保存
+	if ts, err := strconv.ParseInt(expires, 10, 64); err == nil {
+		c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(ts-time.Now().Unix(), 10))
+	}
+
+	h.serve(c, storagePath)
+}
+
+// serve 输出图片或其变体
+func (h *ServeHandler) serve(c *gin.Context, storagePath string) {
+	opts, err := parseVariantOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			err.Error(),
+		))
+		return
+	}
+
+	opts, err = h.variants.Validate(opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 响应内容随 Accept 变化，告知缓存按 Accept 区分
+	if opts.Format == "" && h.variants.Negotiates() {
+		c.Header("Vary", "Accept")
+		opts.Format = h.variants.Negotiate(storagePath, acceptsFormat(c.GetHeader("Accept")))
+	}
+
+	img, err := h.variants.Open(c.Request.Context(), storagePath, opts)
+	if err != nil {
+		// 不暴露存储层路径信息
+		if errors.Is(err, storage.ErrNotExist) || errors.Is(err, storage.ErrInvalidPath) {
+			err = service.ErrImageNotFound
+		}
+		respondError(c, err)
+		return
+	}
+	defer img.Reader.Close()
+
+	c.Header("Content-Type", img.ContentType)
+
+	// 本地文件支持 Range / If-Modified-Since 等条件请求
+	if rs, ok := img.Reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", img.ModTime, rs)
+		return
+	}
+
+	if !img.ModTime.IsZero() {
+		c.Header("Last-Modified", img.ModTime.UTC().Format(http.TimeFormat))
+	}
+	c.DataFromReader(http.StatusOK, img.Size, img.ContentType, img.Reader, nil)
+}
+
+// parseVariantOptions 解析变体参数
+func parseVariantOptions(c *gin.Context) (service.VariantOptions, error) {
+	var opts service.VariantOptions
+	var err error
+
+	if opts.Width, err = queryInt(c, "w"); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = queryInt(c, "h"); err != nil {
+		return opts, err
+	}
+	if opts.Quality, err = queryInt(c, "q"); err != nil {
+		return opts, err
+	}
+	opts.Fit = strings.ToLower(c.Query("fit"))
+	opts.Format = strings.ToLower(c.Query("fmt"))
+	if opts.Format == "jpg" {
+		opts.Format = service.FormatJPEG
+	}
+
+	return opts, nil
+}
+
+// acceptsFormat 根据 Accept 头判断客户端是否支持某种图片格式
+// JPEG、PNG、GIF 所有客户端都支持；WebP、AVIF 必须在 Accept 中明确列出，
+// 通配符 (image/*、*/*) 不代表支持，旧浏览器和邮件客户端同样会发送通配符
+func acceptsFormat(accept string) func(format string) bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		// q=0 表示明确不接受
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			accepted[mediaType] = true
+		}
+	}
+
+	return func(format string) bool {
+		switch format {
+		case service.FormatJPEG, service.FormatPNG, service.FormatGIF:
+			return true
+		case service.FormatWebP:
+			return accepted["image/webp"]
+		case service.FormatAVIF:
+			return accepted["image/avif"]
+		default:
+			return false
+		}
+	}
+}
+
+// queryInt 解析正整数查询参数，未提供时返回 0
+func queryInt(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid parameter " + key + ": " + value)
+	}
+	return n, nil
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServeRouter 创建只注册图片访问路由的测试服务，数据保存在临时目录
+func newTestServeRouter(t *testing.T) (*gin.Engine, *service.ImageService) {
+	t.Helper()
+	images, _ := newTestImageService(t, newTestConfig(t))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewServeHandler(images)
+	r.GET("/images/*filepath", h.Serve)
+	r.HEAD("/images/*filepath", h.Serve)
+	r.GET(service.PrivateURLPrefix+"/*filepath", h.ServePrivate)
+	return r, images
+}
+
+// uploadTestPNG 上传纯色 PNG，返回保存的元数据
+func uploadTestPNG(t *testing.T, images *service.ImageService, c color.Color, visibility string) *model.Image {
+	t.Helper()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("png.Encode error: %v", err)
+	}
+
+	result, err := images.Upload(context.Background(), &buf, int64(buf.Len()), service.UploadOptions{Visibility: visibility})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+	img, err := images.GetImage(context.Background(), nil, result.ID)
+	if err != nil {
+		t.Fatalf("GetImage error: %v", err)
+	}
+	if len(img.Thumbnails) == 0 {
+		t.Fatal("uploaded image has no thumbnails")
+	}
+	return img
+}
+
+func serveRequest(r *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestServeHidesPrivateImages(t *testing.T) {
+	r, images := newTestServeRouter(t)
+	private := uploadTestPNG(t, images, color.RGBA{R: 255, A: 255}, model.VisibilityPrivate)
+	public := uploadTestPNG(t, images, color.RGBA{B: 255, A: 255}, model.VisibilityPublic)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"私有图片", http.MethodGet, private.URL, http.StatusNotFound},
+		{"私有图片 HEAD", http.MethodHead, private.URL, http.StatusNotFound},
+		{"私有图片的缩略图", http.MethodGet, private.Thumbnails[0].URL, http.StatusNotFound},
+		{"私有图片的变体", http.MethodGet, private.URL + "?w=100", http.StatusNotFound},
+		{"私有图片的格式变体", http.MethodGet, private.URL + "?fmt=png", http.StatusNotFound},
+		{"私有图片缩略图的变体", http.MethodGet, private.Thumbnails[0].URL + "?w=100&fmt=jpeg", http.StatusNotFound},
+		{"公开图片", http.MethodGet, public.URL, http.StatusOK},
+		{"公开图片的缩略图", http.MethodGet, public.Thumbnails[0].URL, http.StatusOK},
+		{"公开图片的变体", http.MethodGet, public.URL + "?w=100", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveRequest(r, tt.method, tt.target)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s status = %d, want %d, body: %s", tt.method, tt.target, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServePrivateSignedURL(t *testing.T) {
+	r, images := newTestServeRouter(t)
+	img := uploadTestPNG(t, images, color.RGBA{G: 255, A: 255}, model.VisibilityPrivate)
+	other := uploadTestPNG(t, images, color.RGBA{R: 255, G: 255, A: 255}, model.VisibilityPrivate)
+
+	signed, err := images.SignURL(context.Background(), nil, img.ID, 0)
+	if err != nil {
+		t.Fatalf("SignURL error: %v", err)
+	}
+	thumb := signed.Thumbnails[img.Thumbnails[0].Name]
+	sig := signed.URL[strings.Index(signed.URL, "?"):]
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"签名地址", signed.URL, http.StatusOK},
+		{"签名地址的变体", signed.URL + "&w=100", http.StatusOK},
+		{"缩略图签名地址", thumb, http.StatusOK},
+		{"缺少签名", strings.TrimSuffix(signed.URL, sig), http.StatusForbidden},
+		{"篡改签名", strings.Replace(signed.URL, "sig=", "sig=0", 1), http.StatusForbidden},
+		{"用于其他图片", service.PrivateURLPrefix + "/" + other.StoragePath + sig, http.StatusForbidden},
+		{"主图签名用于缩略图", thumb[:strings.Index(thumb, "?")] + sig, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveRequest(r, http.MethodGet, tt.target)
+			if w.Code != tt.want {
+				t.Fatalf("GET %s status = %d, want %d, body: %s", tt.target, w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusOK && !strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+				t.Errorf("Cache-Control = %q, want private", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
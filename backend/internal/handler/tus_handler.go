@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"image-hosting/internal/middleware"
+	"image-hosting/internal/model"
+	"image-hosting/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tus 协议常量
+// 协议规范: https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// TusHandler 断点续传处理器
+// 实现 tus 1.0 核心协议及 creation、termination、expiration 扩展
+type TusHandler struct {
+	uploads *service.ResumableUploadService
+}
+
+// NewTusHandler 创建断点续传处理器
+func NewTusHandler(uploads *service.ResumableUploadService) *TusHandler {
+	return &TusHandler{
+		uploads: uploads,
+	}
+}
+
+// TusResumableMiddleware 校验并设置 Tus-Resumable 头部
+// OPTIONS 请求不要求客户端携带版本号
+func TusResumableMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Options 返回服务端支持的协议信息
+// OPTIONS /api/v1/tus
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.uploads.MaxSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create 创建上传
+// POST /api/v1/tus
+// Header: Upload-Length (必需), Upload-Metadata (可选)
+func (h *TusHandler) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"missing or invalid Upload-Length header",
+		))
+		return
+	}
+
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"invalid Upload-Metadata header: "+err.Error(),
+		))
+		return
+	}
+
+	session, err := h.uploads.Create(c.Request.Context(), middleware.CurrentUser(c), length, metadata)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID)
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Head 查询上传进度
+// HEAD /api/v1/tus/:id
+func (h *TusHandler) Head(c *gin.Context) {
+	session, err := h.uploads.Get(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"))
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		if errors.Is(err, service.ErrUploadNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	setTusSessionHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// Patch 上传数据块
+// PATCH /api/v1/tus/:id
+// Header: Upload-Offset, Content-Type: application/offset+octet-stream
+// 最后一块接收完成后同步处理图片，X-Image-Id 头部返回生成的图片 ID
+func (h *TusHandler) Patch(c *gin.Context) {
+	if c.ContentType() != tusChunkType {
+		c.JSON(http.StatusUnsupportedMediaType, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"Content-Type must be "+tusChunkType,
+		))
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse(
+			model.CodeBadRequest,
+			"missing or invalid Upload-Offset header",
+		))
+		return
+	}
+
+	session, result, err := h.uploads.Append(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"), offset, c.Request.Body)
+	if session != nil {
+		setTusSessionHeaders(c, session)
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if result != nil {
+		c.Header("X-Image-Id", result.ID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Delete 终止上传
+// DELETE /api/v1/tus/:id
+func (h *TusHandler) Delete(c *gin.Context) {
+	if err := h.uploads.Terminate(c.Request.Context(), middleware.CurrentUser(c), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Result 获取上传完成后生成的图片信息
+// GET /api/v1/tus/:id (非 tus 标准接口)
+func (h *TusHandler) Result(c *gin.Context) {
+	img, err := h.uploads.Result(c.Request.Context(), middleware.CurrentUser(c), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NewSuccessResponse(img))
+}
+
+// setTusSessionHeaders 设置上传进度相关头部
+func setTusSessionHeaders(c *gin.Context, session *service.UploadSession) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseTusMetadata 解析 Upload-Metadata 头部
+// 格式: key base64(value),key2 base64(value2)，value 可省略
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, errors.New("malformed pair: " + pair)
+		}
+	}
+	return metadata, nil
+}
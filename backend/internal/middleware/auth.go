@@ -3,19 +3,24 @@
 package middleware
 
 import (
+	"encoding/base64"
 	"net/http"
 	"strings"
 
 	"image-hosting/internal/config"
 	"image-hosting/internal/model"
+	"image-hosting/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
+// UserKey 鉴权通过后当前用户 (*model.User) 在 gin.Context 中的键
+const UserKey = "user"
+
 // AuthMiddleware 创建鉴权中间件
-// 使用 Bearer Token 方式进行 API 鉴权
+// 支持 Bearer Token 与 Basic (用户名密码) 两种方式，鉴权通过后将用户保存到 UserKey
 // 设计为可配置开关，便于开发调试
-func AuthMiddleware(cfg *config.AuthConfig) gin.HandlerFunc {
+func AuthMiddleware(cfg *config.AuthConfig, accounts *service.AccountService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 如果鉴权未启用，直接放行
 		if !cfg.Enabled {
@@ -34,47 +39,89 @@ func AuthMiddleware(cfg *config.AuthConfig) gin.HandlerFunc {
 			return
 		}
 
-		// 解析 Bearer Token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		// 解析 Bearer Token 或 Basic 凭据
+		user, ok := authenticate(authHeader, accounts)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, model.NewErrorResponse(
 				model.CodeUnauthorized,
-				"invalid authorization format, expected: Bearer <token>",
+				"invalid authorization format, expected: Bearer <token> or Basic <credentials>",
 			))
 			c.Abort()
 			return
 		}
 
-		token := parts[1]
-
-		// 验证 Token
-		if !validateToken(token, cfg.Tokens) {
+		// 验证 Token 或用户名密码
+		if user == nil {
 			c.JSON(http.StatusUnauthorized, model.NewErrorResponse(
 				model.CodeUnauthorized,
-				"invalid token",
+				"invalid credentials",
 			))
 			c.Abort()
 			return
 		}
 
-		// Token 有效，继续处理
+		// 鉴权通过，继续处理
+		c.Set(UserKey, user)
 		c.Next()
 	}
 }
 
-// validateToken 验证 Token 是否在允许列表中
-func validateToken(token string, allowedTokens []string) bool {
-	for _, t := range allowedTokens {
-		if t == token {
-			return true
+// authenticate 解析 Authorization 头部并验证
+// 格式错误时 ok 为 false；凭据无效时返回 nil, true
+func authenticate(authHeader string, accounts *service.AccountService) (*model.User, bool) {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "bearer":
+		return accounts.AuthenticateToken(parts[1]), true
+	case "basic":
+		data, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, false
+		}
+		username, password, found := strings.Cut(string(data), ":")
+		if !found {
+			return nil, false
 		}
+		return accounts.AuthenticatePassword(username, password), true
+	default:
+		return nil, false
 	}
-	return false
+}
+
+// RequireScope 要求当前用户拥有指定权限，否则返回 403
+// 在 AuthMiddleware 之后使用；未启用鉴权时直接放行
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := CurrentUser(c); user != nil && !user.HasScope(scope) {
+			c.JSON(http.StatusForbidden, model.NewErrorResponse(
+				model.CodeForbidden,
+				"insufficient scope, required: "+scope,
+			))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser 获取鉴权通过的当前用户
+// 未启用鉴权时返回 nil，此时不限制访问范围
+func CurrentUser(c *gin.Context) *model.User {
+	if v, ok := c.Get(UserKey); ok {
+		if user, ok := v.(*model.User); ok {
+			return user
+		}
+	}
+	return nil
 }
 
 // OptionalAuthMiddleware 可选鉴权中间件
 // 用于某些接口需要区分已认证和未认证用户的场景
-func OptionalAuthMiddleware(cfg *config.AuthConfig) gin.HandlerFunc {
+func OptionalAuthMiddleware(cfg *config.AuthConfig, accounts *service.AccountService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !cfg.Enabled {
 			c.Next()
@@ -89,16 +136,10 @@ func OptionalAuthMiddleware(cfg *config.AuthConfig) gin.HandlerFunc {
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.Set("authenticated", false)
-			c.Next()
-			return
-		}
-
-		token := parts[1]
-		if validateToken(token, cfg.Tokens) {
+		user, _ := authenticate(authHeader, accounts)
+		if user != nil {
 			c.Set("authenticated", true)
+			c.Set(UserKey, user)
 		} else {
 			c.Set("authenticated", false)
 		}
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"log"
+	"net/http"
 	"time"
 
+	"image-hosting/internal/model"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -49,7 +52,12 @@ func LoggerMiddleware() gin.HandlerFunc {
 }
 
 // RecoveryMiddleware panic 恢复中间件
-// 捕获 panic，防止服务崩溃
+// 捕获 panic，防止服务崩溃，并返回统一格式的错误响应
 func RecoveryMiddleware() gin.HandlerFunc {
-	return gin.Recovery()
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse(
+			model.CodeInternalError,
+			model.InternalErrorMessage,
+		))
+	})
 }
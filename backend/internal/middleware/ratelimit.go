@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sweepInterval 清理空闲令牌桶的间隔
+const sweepInterval = time.Minute
+
+// RateLimiter 令牌桶限流器
+// 每个客户端一个令牌桶，以固定速率补充令牌，每个请求消耗一个
+type RateLimiter struct {
+	rate  float64 // 每秒补充的令牌数
+	burst float64 // 令牌桶容量
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket 单个客户端的令牌桶
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitResult 单次请求的限流结果
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int           // 剩余可用请求数
+	reset      time.Duration // 令牌桶补满所需时间
+	retryAfter time.Duration // 被拒绝时距下一个令牌的时间
+}
+
+// NewRateLimiter 创建令牌桶限流器
+// rule.RequestsPerMinute 不大于 0 时返回 nil，表示不限制；Burst 小于 1 时按 1 处理
+func NewRateLimiter(rule config.RateLimitRule) *RateLimiter {
+	if rule.RequestsPerMinute <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:    rule.RequestsPerMinute / 60,
+		burst:   math.Max(1, float64(rule.Burst)),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// take 为 key 对应的客户端消耗一个令牌
+func (l *RateLimiter) take(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	result := rateLimitResult{allowed: b.tokens >= 1}
+	if result.allowed {
+		b.tokens--
+	} else {
+		result.retryAfter = l.wait(1 - b.tokens)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = l.wait(l.burst - b.tokens)
+	return result
+}
+
+// refund 退还 take 消耗的令牌
+func (l *RateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// wait 补充 n 个令牌所需的时间
+func (l *RateLimiter) wait(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// sweepLocked 定期删除已补满的令牌桶，补满的桶与新建的桶等价
+// 调用前需持有 mu
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware 创建限流中间件
+// 在 AuthMiddleware 之后使用: 已鉴权的请求按 Authorization 凭据计数，未启用鉴权时按客户端 IP 计数
+// 响应附带 X-RateLimit-Limit / X-RateLimit-Remaining / X-RateLimit-Reset 头，超出限制时返回 429 与 Retry-After 头
+// limiter 为 nil 时直接放行
+func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		result := limiter.take(rateLimitKey(c), time.Now())
+		c.Header("X-RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+		if !result.allowed {
+			rejectTooManyRequests(c, result.retryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthFailureLimitMiddleware 按客户端 IP 限制鉴权失败的次数
+// 在 AuthMiddleware 之前使用: 每个请求先预占一个令牌，鉴权通过 (响应不是 401) 时退还，
+// 令牌耗尽的 IP 直接返回 429，不再校验凭据，避免暴力猜测与大量 bcrypt 校验占用 CPU
+// limiter 为 nil 时直接放行
+func AuthFailureLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		key := "ip:" + c.ClientIP()
+		result := limiter.take(key, time.Now())
+		if !result.allowed {
+			rejectTooManyRequests(c, result.retryAfter)
+			return
+		}
+
+		c.Next()
+		if c.Writer.Status() != http.StatusUnauthorized {
+			limiter.refund(key)
+		}
+	}
+}
+
+// rejectTooManyRequests 返回 429 与 Retry-After 头
+func rejectTooManyRequests(c *gin.Context, wait time.Duration) {
+	retryAfter := ceilSeconds(wait)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, model.NewErrorResponseWithDetails(
+		model.CodeTooManyRequests,
+		"too many requests, retry after "+strconv.Itoa(retryAfter)+"s",
+		map[string]interface{}{"retry_after": retryAfter},
+	))
+	c.Abort()
+}
+
+// rateLimitKey 限流计数的客户端标识
+// 只保存凭据的哈希，不在内存中保留 Token 明文
+func rateLimitKey(c *gin.Context) string {
+	if CurrentUser(c) != nil {
+		sum := sha256.Sum256([]byte(c.GetHeader("Authorization")))
+		return "token:" + hex.EncodeToString(sum[:16])
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds 向上取整到秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	if l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 0, Burst: 10}); l != nil {
+		t.Error("NewRateLimiter with 0 rpm should return nil")
+	}
+	if l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: -1, Burst: 10}); l != nil {
+		t.Error("NewRateLimiter with negative rpm should return nil")
+	}
+
+	// Burst 小于 1 时按 1 处理
+	l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 60, Burst: 0})
+	now := time.Now()
+	if r := l.take("k", now); !r.allowed {
+		t.Fatal("first request rejected with burst 0")
+	}
+	if r := l.take("k", now); r.allowed {
+		t.Error("second request allowed with burst 0, want capacity 1")
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	// 每秒补充 1 个令牌，容量 3
+	l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 60, Burst: 3})
+	t0 := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name          string
+		key           string
+		at            time.Duration // 相对 t0 的时间
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+		wantReset     time.Duration
+	}{
+		{"第 1 个请求", "a", 0, true, 2, 0, time.Second},
+		{"第 2 个请求", "a", 0, true, 1, 0, 2 * time.Second},
+		{"第 3 个请求", "a", 0, true, 0, 0, 3 * time.Second},
+		{"令牌耗尽", "a", 0, false, 0, time.Second, 3 * time.Second},
+		{"补充半个令牌", "a", 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		{"其他客户端不受影响", "b", 500 * time.Millisecond, true, 2, 0, time.Second},
+		{"补充满一个令牌", "a", time.Second, true, 0, 0, 3 * time.Second},
+		{"长时间空闲后不超过容量", "a", time.Hour, true, 2, 0, time.Second},
+	}
+
+	for _, tt := range steps {
+		r := l.take(tt.key, t0.Add(tt.at))
+		if r.allowed != tt.wantAllowed || r.remaining != tt.wantRemaining || r.retryAfter != tt.wantRetry || r.reset != tt.wantReset {
+			t.Errorf("%s: take = {allowed %v, remaining %d, retryAfter %v, reset %v}, want {%v, %d, %v, %v}",
+				tt.name, r.allowed, r.remaining, r.retryAfter, r.reset,
+				tt.wantAllowed, tt.wantRemaining, tt.wantRetry, tt.wantReset)
+		}
+	}
+}
+
+func TestRateLimiterRefund(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 60, Burst: 2})
+	now := time.Now()
+
+	l.take("a", now)
+	l.take("a", now)
+	l.refund("a")
+	if r := l.take("a", now); !r.allowed {
+		t.Fatal("request rejected after refund")
+	}
+	if r := l.take("a", now); r.allowed {
+		t.Fatal("refund returned more than one token")
+	}
+
+	// 退还不超过容量
+	l.take("b", now)
+	l.refund("b")
+	l.refund("b")
+	if r := l.take("b", now); r.remaining != 1 {
+		t.Errorf("remaining after extra refunds = %d, want 1", r.remaining)
+	}
+
+	// 没有令牌桶的客户端
+	l.refund("unknown")
+	if _, ok := l.buckets["unknown"]; ok {
+		t.Error("refund created a bucket")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 60, Burst: 120})
+	t0 := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	l.take("idle", t0)
+	for i := 0; i < 100; i++ {
+		l.take("busy", t0)
+	}
+
+	// 超过清理间隔后，已补满的令牌桶被删除，未补满的保留
+	l.take("new", t0.Add(sweepInterval+time.Second))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket that is not yet refilled was swept")
+	}
+}
+
+// newRateLimitContext 创建来自 remoteAddr 的测试请求上下文
+func newRateLimitContext(remoteAddr, authorization string, user *model.User) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/images", nil)
+	c.Request.RemoteAddr = remoteAddr
+	if authorization != "" {
+		c.Request.Header.Set("Authorization", authorization)
+	}
+	if user != nil {
+		c.Set(UserKey, user)
+	}
+	return c
+}
+
+func TestRateLimitKey(t *testing.T) {
+	alice := &model.User{Username: "alice", Role: model.RoleUser}
+
+	anonymous := rateLimitKey(newRateLimitContext("192.0.2.1:1234", "", nil))
+	if anonymous != "ip:192.0.2.1" {
+		t.Errorf("key without user = %q, want ip:192.0.2.1", anonymous)
+	}
+	// 未鉴权时 Authorization 头不影响计数
+	if got := rateLimitKey(newRateLimitContext("192.0.2.1:5678", "Bearer forged", nil)); got != anonymous {
+		t.Errorf("key with unverified Authorization = %q, want %q", got, anonymous)
+	}
+
+	tokenA := rateLimitKey(newRateLimitContext("192.0.2.1:1234", "Bearer token-a", alice))
+	if !strings.HasPrefix(tokenA, "token:") {
+		t.Errorf("key with user = %q, want token: prefix", tokenA)
+	}
+	if strings.Contains(tokenA, "token-a") {
+		t.Errorf("key %q contains the credential", tokenA)
+	}
+	// 同一凭据在不同 IP 共用计数
+	if got := rateLimitKey(newRateLimitContext("198.51.100.7:80", "Bearer token-a", alice)); got != tokenA {
+		t.Errorf("same token from another IP: key = %q, want %q", got, tokenA)
+	}
+	// 同一用户的不同凭据 (如多个 API Key) 分别计数
+	if got := rateLimitKey(newRateLimitContext("192.0.2.1:1234", "Bearer token-b", alice)); got == tokenA {
+		t.Error("different tokens share the same key")
+	}
+}
+
+// newRateLimitRouter 创建使用 mw 的测试路由，status 为处理函数返回的状态码
+func newRateLimitRouter(mw gin.HandlerFunc, status *int, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw)
+	r.GET("/", func(c *gin.Context) {
+		*calls++
+		c.Status(*status)
+	})
+	return r
+}
+
+func doRateLimitRequest(r *gin.Engine, remoteAddr string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	// 每分钟 1 个令牌，测试期间补充的令牌可以忽略
+	limiter := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 1, Burst: 2})
+	status, calls := http.StatusOK, 0
+	r := newRateLimitRouter(RateLimitMiddleware(limiter), &status, &calls)
+
+	// 令牌桶容量 2，每个令牌需要 60 秒补充
+	for i, want := range []struct{ remaining, reset string }{{"1", "60"}, {"0", "120"}} {
+		w := doRateLimitRequest(r, "192.0.2.1:1234")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d X-RateLimit-Limit = %q, want 2", i+1, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != want.remaining {
+			t.Errorf("request %d X-RateLimit-Remaining = %q, want %s", i+1, got, want.remaining)
+		}
+		if got := w.Header().Get("X-RateLimit-Reset"); got != want.reset {
+			t.Errorf("request %d X-RateLimit-Reset = %q, want %s", i+1, got, want.reset)
+		}
+	}
+
+	w := doRateLimitRequest(r, "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request 3 status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("rejected X-RateLimit-Remaining = %q, want 0", got)
+	}
+	var resp struct {
+		Code    int                    `json:"code"`
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body %q: %v", w.Body.String(), err)
+	}
+	if resp.Code != model.CodeTooManyRequests || resp.Details["retry_after"] != float64(60) {
+		t.Errorf("response = %+v, want code %d with retry_after 60", resp, model.CodeTooManyRequests)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+
+	// 其他客户端不受影响
+	if w := doRateLimitRequest(r, "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitMiddlewareDisabled(t *testing.T) {
+	status, calls := http.StatusOK, 0
+	r := newRateLimitRouter(RateLimitMiddleware(nil), &status, &calls)
+	for i := 0; i < 5; i++ {
+		w := doRateLimitRequest(r, "192.0.2.1:1234")
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("request %d: status %d, X-RateLimit-Limit %q; want 200 without rate limit headers",
+				i+1, w.Code, w.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+}
+
+func TestAuthFailureLimitMiddleware(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitRule{RequestsPerMinute: 1, Burst: 2})
+	status, calls := http.StatusOK, 0
+	r := newRateLimitRouter(AuthFailureLimitMiddleware(limiter), &status, &calls)
+	const addr = "192.0.2.1:1234"
+
+	// 响应不是 401 时退还令牌，不限制正常请求
+	for _, status = range []int{http.StatusOK, http.StatusForbidden, http.StatusNotFound, http.StatusOK, http.StatusTooManyRequests} {
+		if w := doRateLimitRequest(r, addr); w.Code != status {
+			t.Fatalf("status %d request returned %d", status, w.Code)
+		}
+	}
+
+	// 鉴权失败消耗令牌
+	status = http.StatusUnauthorized
+	for i := 0; i < 2; i++ {
+		if w := doRateLimitRequest(r, addr); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d status = %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// 令牌耗尽后不再校验凭据，正确的凭据同样被拒绝
+	status = http.StatusOK
+	calls = 0
+	w := doRateLimitRequest(r, addr)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after failures = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if calls != 0 {
+		t.Error("handler called after the limit was reached")
+	}
+
+	// 其他 IP 不受影响
+	if w := doRateLimitRequest(r, "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// API 权限范围
+// 每个接口要求其中一项，admin 包含其他全部权限
+const (
+	ScopeUpload = "upload" // 上传图片 (含批量上传、URL 上传与断点续传)
+	ScopeRead   = "read"   // 查看图片列表、详情、原图与异步任务
+	ScopeDelete = "delete" // 删除图片
+	ScopeAdmin  = "admin"  // 管理 API Key
+)
+
+// APIKey API Key 信息
+// 只保存加盐哈希，Key 本身只在创建时返回一次
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`                   // 用途说明
+	Prefix     string     `json:"prefix"`                 // Key 的开头部分，用于识别
+	Username   string     `json:"username"`               // 所属用户，使用 Key 上传的图片属于该用户
+	Scopes     []string   `json:"scopes"`                 // 权限范围
+	CreatedAt  time.Time  `json:"created_at"`             // 创建时间
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // 过期时间，为空表示不过期
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // 最后使用时间 (精确到分钟)
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`   // 吊销时间
+	Quota      *Quota     `json:"quota,omitempty"`        // 使用该 Key 上传的配额，与所属用户的配额同时生效
+}
+
+// CreatedAPIKey 创建 API Key 的结果
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"` // 完整的 Key，只返回这一次
+}
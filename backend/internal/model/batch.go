@@ -0,0 +1,41 @@
+package model
+
+// BatchUploadResult 批量上传结果
+// 每个文件单独成功或失败，items 与请求中的文件顺序一致
+type BatchUploadResult struct {
+	Total     int               `json:"total"`     // 文件数
+	Succeeded int               `json:"succeeded"` // 成功数
+	Failed    int               `json:"failed"`    // 失败数
+	Items     []BatchUploadItem `json:"items"`
+}
+
+// BatchUploadItem 批量上传中单个文件的结果
+// code / message / error_code / details 与单文件上传的响应含义相同
+type BatchUploadItem struct {
+	Index     int                    `json:"index"`    // 在请求中的序号，从 0 开始
+	Filename  string                 `json:"filename"` // 客户端提供的文件名
+	Code      int                    `json:"code"`     // 0 表示成功
+	Message   string                 `json:"message"`
+	ErrorCode string                 `json:"error_code,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Result    *UploadResult          `json:"result,omitempty"` // 上传结果 (同步上传成功时)
+	Job       *Job                   `json:"job,omitempty"`    // 异步任务 (async=true 时)
+}
+
+// NewBatchUploadResult 创建批量上传结果
+func NewBatchUploadResult(total int) *BatchUploadResult {
+	return &BatchUploadResult{
+		Total: total,
+		Items: make([]BatchUploadItem, 0, total),
+	}
+}
+
+// Add 添加单个文件的结果并计数
+func (r *BatchUploadResult) Add(item BatchUploadItem) {
+	if item.Code == CodeSuccess {
+		r.Succeeded++
+	} else {
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
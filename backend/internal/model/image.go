@@ -7,40 +7,117 @@ import "time"
 // Image 图片信息模型
 // 包含图片的所有元数据，用于 API 响应
 type Image struct {
-	ID             string    `json:"id"`               // 图片唯一标识 (UUID)
-	URL            string    `json:"url"`              // 图片访问 URL
-	OriginalFormat string    `json:"original_format"`  // 原始格式 (jpeg/png/webp)
-	OriginalSize   int64     `json:"original_size"`    // 原始文件大小 (bytes)
-	ProcessedSize  int64     `json:"processed_size"`   // 处理后文件大小 (bytes)
-	Width          int       `json:"width"`            // 图片宽度
-	Height         int       `json:"height"`           // 图片高度
-	CreatedAt      time.Time `json:"created_at"`       // 上传时间
-	Filename       string    `json:"filename"`         // 存储文件名
-	StoragePath    string    `json:"-"`                // 存储路径 (不暴露给前端)
+	ID             string      `json:"id"`                       // 图片唯一标识 (UUID)
+	URL            string      `json:"url,omitempty"`            // 图片访问 URL，私有图片不返回 (需通过签名地址访问)
+	OriginalFormat string      `json:"original_format"`          // 原始格式 (jpeg/png/webp)
+	Format         string      `json:"format"`                   // 输出格式 (webp/avif)
+	OriginalSize   int64       `json:"original_size"`            // 原始文件大小 (bytes)
+	ProcessedSize  int64       `json:"processed_size"`           // 处理后文件大小 (bytes)
+	Width          int         `json:"width"`                    // 图片宽度
+	Height         int         `json:"height"`                   // 图片高度
+	Animated       bool        `json:"animated,omitempty"`       // 是否为动图 (GIF / 动画 WebP)
+	FrameCount     int         `json:"frame_count,omitempty"`    // 动图帧数
+	CreatedAt      time.Time   `json:"created_at"`               // 上传时间
+	Filename       string      `json:"filename"`                 // 存储文件名
+	StoragePath    string      `json:"-"`                        // 存储路径 (不暴露给前端)
+	Thumbnails     []Thumbnail `json:"thumbnails,omitempty"`     // 缩略图列表
+	ContentHash    string      `json:"content_hash,omitempty"`   // 原始文件 SHA-256
+	ProcessedHash  string      `json:"processed_hash,omitempty"` // 处理后文件 SHA-256
+	RefCount       int         `json:"ref_count,omitempty"`      // 引用计数，重复上传时递增，删除时递减
+	Exif           *Exif       `json:"exif,omitempty"`           // 拍摄信息，保留范围由 image.exif.policy 决定
+	SourceURL      string      `json:"source_url,omitempty"`     // 通过 URL 上传时的来源地址
+	HasOriginal    bool        `json:"has_original,omitempty"`   // 是否保存了原图，可通过 /api/v1/image/:id/original 下载
+	OwnerID        string      `json:"owner_id,omitempty"`       // 上传者用户名，未启用鉴权或使用不属于用户的 Token 上传时为空
+	KeyID          string      `json:"key_id,omitempty"`         // 上传时使用的 API Key，用于统计 Key 的配额
+	Visibility     string      `json:"visibility,omitempty"`     // 可见性: public / private，为空表示 public
+}
+
+// 图片可见性
+const (
+	VisibilityPublic  = "public"  // 任何人都可以通过 /images 访问
+	VisibilityPrivate = "private" // 只能通过签名地址访问
+)
+
+// IsPrivate 是否为私有图片
+// 未记录可见性的旧图片为公开
+func (img *Image) IsPrivate() bool {
+	return img.Visibility == VisibilityPrivate
+}
+
+// Exif 拍摄信息
+// 从原图 EXIF 中提取，缺失的字段不返回
+type Exif struct {
+	Make         string  `json:"make,omitempty"`          // 相机厂商
+	Model        string  `json:"model,omitempty"`         // 相机型号
+	LensModel    string  `json:"lens_model,omitempty"`    // 镜头型号
+	TakenAt      string  `json:"taken_at,omitempty"`      // 拍摄时间 (相机本地时间，不含时区)，如 2024-12-01T15:04:05
+	ExposureTime string  `json:"exposure_time,omitempty"` // 曝光时间 (秒)，如 1/125
+	FNumber      float64 `json:"f_number,omitempty"`      // 光圈值
+	ISO          int     `json:"iso,omitempty"`           // 感光度
+	FocalLength  float64 `json:"focal_length,omitempty"`  // 焦距 (mm)
+	GPS          *GPS    `json:"gps,omitempty"`           // 拍摄位置
+}
+
+// GPS 拍摄位置
+type GPS struct {
+	Latitude  float64  `json:"latitude"`           // 纬度，南纬为负
+	Longitude float64  `json:"longitude"`          // 经度，西经为负
+	Altitude  *float64 `json:"altitude,omitempty"` // 海拔 (米)，海平面以下为负
+}
+
+// Thumbnail 缩略图信息
+// 上传时按配置的尺寸生成，与主图存放在同一目录
+type Thumbnail struct {
+	Name   string `json:"name"`          // 尺寸名称，对应配置中的 name
+	URL    string `json:"url,omitempty"` // 访问 URL，私有图片不返回
+	Width  int    `json:"width"`         // 宽度
+	Height int    `json:"height"`        // 高度
+	Size   int64  `json:"size"`          // 文件大小 (bytes)
 }
 
 // ImageListItem 图片列表项
 // 用于列表展示，包含必要的展示信息
 type ImageListItem struct {
-	ID            string    `json:"id"`
-	URL           string    `json:"url"`
-	ThumbnailURL  string    `json:"thumbnail_url,omitempty"` // 缩略图 URL (预留)
-	OriginalFormat string   `json:"original_format"`
-	ProcessedSize int64     `json:"processed_size"`
-	Width         int       `json:"width"`
-	Height        int       `json:"height"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID             string      `json:"id"`
+	URL            string      `json:"url,omitempty"`
+	ThumbnailURL   string      `json:"thumbnail_url,omitempty"` // 缩略图 URL (第一个配置尺寸)
+	OriginalFormat string      `json:"original_format"`
+	Format         string      `json:"format"` // 输出格式 (webp/avif)
+	ProcessedSize  int64       `json:"processed_size"`
+	Width          int         `json:"width"`
+	Height         int         `json:"height"`
+	Animated       bool        `json:"animated,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	Thumbnails     []Thumbnail `json:"thumbnails,omitempty"` // 全部缩略图
+	OwnerID        string      `json:"owner_id,omitempty"`   // 上传者用户名
+	Visibility     string      `json:"visibility,omitempty"` // 可见性: public / private
 }
 
 // UploadResult 上传结果
 // 上传成功后返回的完整信息
 type UploadResult struct {
-	ID             string    `json:"id"`
-	URL            string    `json:"url"`
-	OriginalFormat string    `json:"original_format"`
-	OriginalSize   int64     `json:"original_size"`
-	ProcessedSize  int64     `json:"processed_size"`
-	Width          int       `json:"width"`
-	Height         int       `json:"height"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID             string      `json:"id"`
+	URL            string      `json:"url,omitempty"`
+	OriginalFormat string      `json:"original_format"`
+	Format         string      `json:"format"`
+	OriginalSize   int64       `json:"original_size"`
+	ProcessedSize  int64       `json:"processed_size"`
+	Width          int         `json:"width"`
+	Height         int         `json:"height"`
+	Animated       bool        `json:"animated,omitempty"`
+	FrameCount     int         `json:"frame_count,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	Thumbnails     []Thumbnail `json:"thumbnails,omitempty"`
+	ContentHash    string      `json:"content_hash,omitempty"`
+	SourceURL      string      `json:"source_url,omitempty"`
+	Visibility     string      `json:"visibility,omitempty"` // 可见性，私有图片需通过签名地址访问
+	Deduplicated   bool        `json:"deduplicated"`         // 是否命中已有图片 (未生成新文件)
+}
+
+// SignedURL 私有图片的签名访问地址
+// 有效期内任何人都可以通过该地址访问，过期后失效
+type SignedURL struct {
+	URL        string            `json:"url"`                  // 图片地址，可附加 w / h / fit / q / fmt 缩放参数
+	ExpiresAt  time.Time         `json:"expires_at"`           // 过期时间
+	Thumbnails map[string]string `json:"thumbnails,omitempty"` // 缩略图名称 -> 地址
 }
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// 异步处理任务状态
+const (
+	JobPending    = "pending"    // 等待处理
+	JobProcessing = "processing" // 正在处理
+	JobCompleted  = "completed"  // 处理完成，结果见 Result
+	JobFailed     = "failed"     // 处理失败，原因见 Error
+)
+
+// Job 异步处理任务
+// 异步上传时原图先保存，立即返回任务，后台处理完成后更新状态
+type Job struct {
+	ID        string        `json:"id"`
+	Status    string        `json:"status"`           // pending / processing / completed / failed
+	CreatedAt time.Time     `json:"created_at"`       // 提交时间
+	UpdatedAt time.Time     `json:"updated_at"`       // 最后一次状态变化时间
+	Result    *UploadResult `json:"result,omitempty"` // 处理结果 (completed)
+	Error     *JobError     `json:"error,omitempty"`  // 失败原因 (failed)
+}
+
+// JobError 任务失败原因
+// 错误码与同步上传失败时响应中的 code / error_code 相同
+type JobError struct {
+	Code      int    `json:"code"`
+	ErrorCode string `json:"error_code"`
+	Message   string `json:"message"`
+}
@@ -0,0 +1,25 @@
+package model
+
+// Quota 配额，0 表示不限制
+type Quota struct {
+	MaxBytes         int64 `json:"max_bytes"`           // 占用的存储空间 (bytes)，包括缩略图与保存的原图
+	MaxImages        int64 `json:"max_images"`          // 图片数量
+	MaxUploadsPerDay int64 `json:"max_uploads_per_day"` // 每天的上传次数 (按服务器本地日期)
+}
+
+// QuotaUsage 配额使用情况
+type QuotaUsage struct {
+	Bytes        int64 `json:"bytes"`         // 已占用的存储空间
+	Images       int64 `json:"images"`        // 图片数量
+	UploadsToday int64 `json:"uploads_today"` // 今天的上传次数
+	Quota        Quota `json:"quota"`         // 配额
+}
+
+// UsageReport 用量查询结果
+// 通过 API Key 访问时同时返回该 Key 的用量
+type UsageReport struct {
+	Username string      `json:"username"`
+	User     QuotaUsage  `json:"user"`
+	KeyID    string      `json:"key_id,omitempty"`
+	Key      *QuotaUsage `json:"key,omitempty"`
+}
@@ -6,22 +6,91 @@ type Response struct {
 	Code    int         `json:"code"`    // 状态码: 0 表示成功，非 0 表示错误
 	Message string      `json:"message"` // 状态消息
 	Data    interface{} `json:"data"`    // 响应数据
+
+	// 以下字段仅在失败时返回
+	ErrorCode string                 `json:"error_code,omitempty"` // 机器可读的错误标识，与 Code 一一对应，如 file_too_large
+	Details   map[string]interface{} `json:"details,omitempty"`    // 错误详情，如 {"max_size": 10485760}
 }
 
 // 预定义错误码
 const (
-	CodeSuccess          = 0
-	CodeBadRequest       = 400
-	CodeUnauthorized     = 401
-	CodeForbidden        = 403
-	CodeNotFound         = 404
-	CodeInternalError    = 500
-	CodeInvalidFileType  = 1001
-	CodeFileTooLarge     = 1002
-	CodeProcessingFailed = 1003
-	CodeStorageFailed    = 1004
+	CodeSuccess           = 0
+	CodeBadRequest        = 400
+	CodeUnauthorized      = 401
+	CodeForbidden         = 403
+	CodeNotFound          = 404
+	CodeTooManyRequests   = 429
+	CodeInternalError     = 500
+	CodeInvalidFileType   = 1001
+	CodeFileTooLarge      = 1002
+	CodeProcessingFailed  = 1003
+	CodeStorageFailed     = 1004
+	CodeVariantNotAllowed = 1005
+	CodeVariantDisabled   = 1006
+	CodeUploadConflict    = 1007
+	CodeUploadLocked      = 1008
+	CodeUnsupportedFormat = 1009
+	CodeTooManyFrames     = 1010
+	CodeImageTooLarge     = 1011
+	CodeServerBusy        = 1012
+	CodeTooManyFiles      = 1013
+	CodeRemoteFetchFailed = 1014
+	CodeRemoteURLBlocked  = 1015
+	CodeQuotaExceeded     = 1016
 )
 
+// InternalErrorMessage 内部错误返回给客户端的信息，具体原因只记录在服务端日志
+const InternalErrorMessage = "internal server error"
+
+// maskedErrorMessages 原始错误可能包含文件路径、存储服务响应、外部程序输出等内部信息的错误码，
+// 对外只返回固定提示，具体原因只记录在服务端日志
+var maskedErrorMessages = map[int]string{
+	CodeInternalError:    InternalErrorMessage,
+	CodeProcessingFailed: "image processing failed",
+	CodeStorageFailed:    "storage operation failed",
+}
+
+// MaskedErrorMessage 返回错误码对应的固定提示，ok 为 false 表示原始错误信息可直接返回给客户端
+func MaskedErrorMessage(code int) (message string, ok bool) {
+	message, ok = maskedErrorMessages[code]
+	return message, ok
+}
+
+// errorCodeNames 错误码对应的机器可读标识
+// 标识对外公开，只能新增，不能修改
+var errorCodeNames = map[int]string{
+	CodeBadRequest:        "bad_request",
+	CodeUnauthorized:      "unauthorized",
+	CodeForbidden:         "forbidden",
+	CodeNotFound:          "not_found",
+	CodeTooManyRequests:   "too_many_requests",
+	CodeInternalError:     "internal_error",
+	CodeInvalidFileType:   "invalid_file_type",
+	CodeFileTooLarge:      "file_too_large",
+	CodeProcessingFailed:  "processing_failed",
+	CodeStorageFailed:     "storage_failed",
+	CodeVariantNotAllowed: "variant_not_allowed",
+	CodeVariantDisabled:   "variant_disabled",
+	CodeUploadConflict:    "upload_conflict",
+	CodeUploadLocked:      "upload_locked",
+	CodeUnsupportedFormat: "unsupported_format",
+	CodeTooManyFrames:     "too_many_frames",
+	CodeImageTooLarge:     "image_too_large",
+	CodeServerBusy:        "server_busy",
+	CodeTooManyFiles:      "too_many_files",
+	CodeRemoteFetchFailed: "remote_fetch_failed",
+	CodeRemoteURLBlocked:  "remote_url_blocked",
+	CodeQuotaExceeded:     "quota_exceeded",
+}
+
+// ErrorCodeName 获取错误码对应的机器可读标识
+func ErrorCodeName(code int) string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return errorCodeNames[CodeInternalError]
+}
+
 // NewSuccessResponse 创建成功响应
 func NewSuccessResponse(data interface{}) Response {
 	return Response{
@@ -34,10 +103,20 @@ func NewSuccessResponse(data interface{}) Response {
 // NewErrorResponse 创建错误响应
 func NewErrorResponse(code int, message string) Response {
 	return Response{
-		Code:    code,
-		Message: message,
-		Data:    nil,
+		Code:      code,
+		Message:   message,
+		Data:      nil,
+		ErrorCode: ErrorCodeName(code),
+	}
+}
+
+// NewErrorResponseWithDetails 创建带详情的错误响应
+func NewErrorResponseWithDetails(code int, message string, details map[string]interface{}) Response {
+	resp := NewErrorResponse(code, message)
+	if len(details) > 0 {
+		resp.Details = details
 	}
+	return resp
 }
 
 // PaginatedList 分页列表响应
@@ -0,0 +1,31 @@
+package model
+
+// 用户角色
+const (
+	RoleAdmin = "admin" // 管理员，可以查看和删除所有图片
+	RoleUser  = "user"  // 普通用户，只能访问自己上传的图片
+)
+
+// User 通过鉴权的调用方
+// 由鉴权中间件根据 Token、API Key 或用户名密码确定
+type User struct {
+	Username string   `json:"username"`         // 用户名，不属于任何用户的 Token 为空
+	Role     string   `json:"role"`             // admin / user
+	Scopes   []string `json:"scopes"`           // 本次请求拥有的权限范围
+	KeyID    string   `json:"key_id,omitempty"` // 使用 API Key 访问时为 Key 的 ID
+}
+
+// IsAdmin 是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// HasScope 是否拥有指定权限，admin 权限包含其他全部权限
+func (u *User) HasScope(scope string) bool {
+	for _, s := range u.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// account 用户账号
+type account struct {
+	user         model.User
+	passwordHash []byte
+	quota        model.Quota
+}
+
+// AccountService 用户账号与 Token 验证
+// 账号在 auth.users 中配置；auth.tokens 中的 Token 不属于任何用户，视为管理员；
+// 通过接口创建的 API Key 保存在 auth.keys_file
+type AccountService struct {
+	accounts map[string]*account    // 用户名 -> 账号
+	tokens   map[string]*model.User // Token -> 所属用户
+
+	mu       sync.Mutex               // 保护 API Key 的读-改-写
+	keysPath string                   // 为空时不支持 API Key
+	keys     map[string]*apiKeyRecord // ID -> API Key
+}
+
+// NewAccountService 根据鉴权配置创建账号服务，并加载已创建的 API Key
+// 用户名、角色与密码哈希在启动时校验，同一 Token 不能分配给多个用户；
+// defaultQuota 为未单独配置配额的用户使用的配额
+func NewAccountService(cfg *config.AuthConfig, defaultQuota *config.QuotaLimits) (*AccountService, error) {
+	s := &AccountService{
+		accounts: make(map[string]*account),
+		tokens:   make(map[string]*model.User),
+		keys:     make(map[string]*apiKeyRecord),
+	}
+	// 未启用鉴权时任何人都能调用管理接口，不支持 API Key
+	if cfg.Enabled {
+		s.keysPath = cfg.KeysFile
+	}
+
+	legacy := &model.User{Role: model.RoleAdmin, Scopes: roleScopes(model.RoleAdmin)}
+	for _, token := range cfg.Tokens {
+		if err := s.addToken(token, legacy); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, u := range cfg.Users {
+		if u.Username == "" {
+			return nil, fmt.Errorf("auth user without username")
+		}
+		if _, ok := s.accounts[u.Username]; ok {
+			return nil, fmt.Errorf("duplicate auth user: %q", u.Username)
+		}
+		if u.Role != model.RoleAdmin && u.Role != model.RoleUser {
+			return nil, fmt.Errorf("invalid role for user %q: %q", u.Username, u.Role)
+		}
+
+		a := &account{user: model.User{Username: u.Username, Role: u.Role, Scopes: roleScopes(u.Role)}}
+		limits := defaultQuota
+		if u.Quota != nil {
+			limits = u.Quota
+		}
+		a.quota = model.Quota{
+			MaxBytes:         limits.MaxBytes,
+			MaxImages:        limits.MaxImages,
+			MaxUploadsPerDay: limits.MaxUploadsPerDay,
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+				return nil, fmt.Errorf("invalid password_hash for user %q: %w", u.Username, err)
+			}
+			a.passwordHash = []byte(u.PasswordHash)
+		}
+		s.accounts[u.Username] = a
+
+		for _, token := range u.Tokens {
+			if err := s.addToken(token, &a.user); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.loadKeys(); err != nil {
+		return nil, fmt.Errorf("failed to load api keys: %w", err)
+	}
+	return s, nil
+}
+
+// roleScopes 角色拥有的全部权限
+// 使用 Token 或密码访问时拥有角色的全部权限，API Key 的权限不能超出所属用户的角色
+func roleScopes(role string) []string {
+	if role == model.RoleAdmin {
+		return []string{model.ScopeUpload, model.ScopeRead, model.ScopeDelete, model.ScopeAdmin}
+	}
+	return []string{model.ScopeUpload, model.ScopeRead, model.ScopeDelete}
+}
+
+// addToken 登记 Token
+func (s *AccountService) addToken(token string, user *model.User) error {
+	if token == "" {
+		return fmt.Errorf("empty auth token for user %q", user.Username)
+	}
+	if _, ok := s.tokens[token]; ok {
+		return fmt.Errorf("duplicate auth token for user %q", user.Username)
+	}
+	s.tokens[token] = user
+	return nil
+}
+
+// AuthenticateToken 验证配置中的 Token 或通过接口创建的 API Key，返回所属用户
+// Token 无效、API Key 已过期或已吊销时返回 nil
+func (s *AccountService) AuthenticateToken(token string) *model.User {
+	if user, ok := s.tokens[token]; ok {
+		u := *user
+		return &u
+	}
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return s.authenticateKey(token)
+	}
+	return nil
+}
+
+// AuthenticatePassword 验证用户名与密码，返回对应用户
+// 用户不存在、未设置密码或密码错误时返回 nil
+// bcrypt 校验较慢，频繁调用的客户端应使用 Token
+func (s *AccountService) AuthenticatePassword(username, password string) *model.User {
+	a, ok := s.accounts[username]
+	if !ok || a.passwordHash == nil {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(a.passwordHash, []byte(password)) != nil {
+		return nil
+	}
+	u := a.user
+	return &u
+}
+
+// HashPassword 生成 auth.users 中使用的 bcrypt 密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// quotaLimits 用户与 API Key 的配额
+// 用户或 Key 不存在时对应的配额为零值 (不限制)
+func (s *AccountService) quotaLimits(ownerID, keyID string) (user, key model.Quota) {
+	if a, ok := s.accounts[ownerID]; ok {
+		user = a.quota
+	}
+	if keyID != "" {
+		s.mu.Lock()
+		if r, ok := s.keys[keyID]; ok && r.Quota != nil {
+			key = *r.Quota
+		}
+		s.mu.Unlock()
+	}
+	return user, key
+}
+
+// canAccess 用户是否可以访问 ownerID 上传的图片
+// user 为 nil 表示未启用鉴权，不做限制
+func canAccess(user *model.User, ownerID string) bool {
+	return user == nil || user.IsAdmin() || user.Username == ownerID
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+)
+
+// Animation 解码后的动画
+// 每一帧都是合成后的完整画布，便于统一缩放与重新编码
+type Animation struct {
+	Frames    []image.Image // 各帧画面
+	Delays    []int         // 各帧显示时长 (毫秒)
+	LoopCount int           // 循环次数，0 表示无限循环
+	Width     int           // 画布宽度
+	Height    int           // 画布高度
+}
+
+// minFrameDelay 浏览器对过短的帧间隔统一按 100ms 处理，转换时保持一致
+const minFrameDelay = 100
+
+// checkAnimationSize 在解码前检查帧数与全部帧的总像素数
+// 合成后每一帧都是完整画布，内存占用为 画布像素 × 帧数 × 4 字节；
+// maxFrames > 0 时超过该帧数返回 ErrTooManyFrames，maxTotalMegapixels > 0 时超过返回 *ImageTooLargeError
+func checkAnimationSize(width, height, frames, maxFrames int, maxTotalMegapixels float64) error {
+	if maxFrames > 0 && frames > maxFrames {
+		return fmt.Errorf("%w: %d (max: %d)", ErrTooManyFrames, frames, maxFrames)
+	}
+	total := float64(width) * float64(height) * float64(frames)
+	if maxTotalMegapixels > 0 && total > maxTotalMegapixels*1e6 {
+		return &ImageTooLargeError{
+			Width:              width,
+			Height:             height,
+			Frames:             frames,
+			MaxTotalMegapixels: maxTotalMegapixels,
+		}
+	}
+	return nil
+}
+
+// gifInfo GIF 的画布尺寸与帧数
+type gifInfo struct {
+	width  int
+	height int
+	frames int
+}
+
+// scanGIF 逐块扫描 GIF，统计帧数并检查各帧是否位于画布内
+// 只读取块头、跳过 LZW 数据，不分配像素内存；
+// 缺少结束符时按已扫描到的帧处理，由随后的完整解码报告错误
+func scanGIF(data []byte) (*gifInfo, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errors.New("gif: invalid header")
+	}
+
+	info := &gifInfo{
+		width:  int(binary.LittleEndian.Uint16(data[6:8])),
+		height: int(binary.LittleEndian.Uint16(data[8:10])),
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1) // 全局颜色表
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展块: 标识 + 类型 + 数据子块
+			pos = skipGIFSubBlocks(data, pos+2)
+
+		case 0x2C: // 图像描述符
+			if pos+10 > len(data) {
+				return info, nil
+			}
+			left := int(binary.LittleEndian.Uint16(data[pos+1:]))
+			top := int(binary.LittleEndian.Uint16(data[pos+3:]))
+			w := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			h := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			if left+w > info.width || top+h > info.height {
+				return nil, errors.New("gif: frame bounds larger than image bounds")
+			}
+
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1) // 局部颜色表
+			}
+			pos = skipGIFSubBlocks(data, pos+1) // 跳过 LZW 最小码长与图像数据
+			info.frames++
+
+		case 0x3B: // 结束符
+			return info, nil
+
+		default:
+			return nil, fmt.Errorf("gif: unknown block type: 0x%.2x", data[pos])
+		}
+	}
+	return info, nil
+}
+
+// skipGIFSubBlocks 跳过以长度为 0 的子块结尾的数据子块序列，返回之后的位置
+func skipGIFSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			break
+		}
+		pos += n
+	}
+	return pos
+}
+
+// decodeGIFAnimation 解码 GIF 的全部帧
+// 按 GIF 的清除方式 (disposal) 合成完整画布
+// 解码前先扫描文件结构，帧数或总像素数超过限制时不分配任何像素内存 (见 checkAnimationSize)
+func decodeGIFAnimation(data []byte, maxFrames int, maxTotalMegapixels float64) (*Animation, error) {
+	info, err := scanGIF(data)
+	if err != nil {
+		return nil, err
+	}
+	if info.frames == 0 {
+		return nil, errors.New("gif: no frames")
+	}
+	if err := checkAnimationSize(info.width, info.height, info.frames, maxFrames, maxTotalMegapixels); err != nil {
+		return nil, err
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, errors.New("gif: no frames")
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	anim := &Animation{
+		Width:  width,
+		Height: height,
+	}
+	// GIF 的 LoopCount: 0 无限循环，-1 只播放一次，n 表示重复 n 次 (共播放 n+1 次)
+	switch {
+	case g.LoopCount == 0:
+		anim.LoopCount = 0
+	case g.LoopCount < 0:
+		anim.LoopCount = 1
+	default:
+		anim.LoopCount = g.LoopCount + 1
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		snapshot := image.NewNRGBA(canvas.Bounds())
+		copy(snapshot.Pix, canvas.Pix)
+		anim.Frames = append(anim.Frames, snapshot)
+
+		delay := 0
+		if i < len(g.Delay) {
+			delay = g.Delay[i] * 10 // GIF 以 1/100 秒为单位
+		}
+		if delay <= 10 {
+			delay = minFrameDelay
+		}
+		anim.Delays = append(anim.Delays, delay)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return anim, nil
+}
+
+// encodeGIFAnimation 将动画编码为 GIF
+// 每一帧都是完整画布，显示后清除，避免透明区域露出上一帧
+func encodeGIFAnimation(anim *Animation) ([]byte, error) {
+	g := &gif.GIF{
+		Config: image.Config{Width: anim.Width, Height: anim.Height},
+	}
+	// WebP 循环次数为总播放次数，GIF 为重复次数
+	switch {
+	case anim.LoopCount == 0:
+		g.LoopCount = 0
+	case anim.LoopCount == 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = anim.LoopCount - 1
+	}
+
+	// Plan9 调色板的最后一个颜色替换为透明色
+	pal := make(color.Palette, len(palette.Plan9))
+	copy(pal, palette.Plan9)
+	pal[len(pal)-1] = color.Transparent
+
+	for i, frame := range anim.Frames {
+		bounds := frame.Bounds()
+		paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), pal)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, bounds.Min)
+
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, anim.Delays[i]/10)
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeAnimation 解码 GIF 或动画 WebP
+// 不是动画 (如单帧 GIF、静态 WebP) 时返回 nil, nil
+func decodeAnimation(data []byte, mimeType string, maxFrames int, maxTotalMegapixels float64) (*Animation, error) {
+	switch {
+	case mimeType == "image/gif":
+		anim, err := decodeGIFAnimation(data, maxFrames, maxTotalMegapixels)
+		if err != nil || len(anim.Frames) < 2 {
+			return nil, err
+		}
+		return anim, nil
+	case mimeType == "image/webp" && isAnimatedWebP(data):
+		return decodeWebPAnimation(data, maxFrames, maxTotalMegapixels)
+	default:
+		return nil, nil
+	}
+}
+
+// Resize 按指定模式缩放全部帧
+func (a *Animation) Resize(p *ImageProcessor, width, height int, fit string) *Animation {
+	resized := &Animation{
+		Delays:    a.Delays,
+		LoopCount: a.LoopCount,
+		Frames:    make([]image.Image, len(a.Frames)),
+	}
+	for i, frame := range a.Frames {
+		resized.Frames[i] = p.Resize(frame, width, height, fit)
+	}
+
+	bounds := resized.Frames[0].Bounds()
+	resized.Width, resized.Height = bounds.Dx(), bounds.Dy()
+	return resized
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// gifFrame 1×1 帧: 图形控制扩展 + 图像描述符 + LZW 数据
+var gifFrame = []byte{
+	0x21, 0xF9, 0x04, 0x00, 0x0A, 0x00, 0x00, 0x00, // 图形控制扩展，延迟 10
+	0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x00, // 图像描述符 (0,0) 1×1，无局部颜色表
+	0x02, 0x02, 0x44, 0x01, 0x00, // LZW 最小码长 2 + 数据子块
+}
+
+// buildGIF 生成 width×height 画布、frames 个 1×1 帧的 GIF (2 色全局颜色表)
+func buildGIF(width, height, frames int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("GIF89a")
+	binary.Write(&buf, binary.LittleEndian, uint16(width))
+	binary.Write(&buf, binary.LittleEndian, uint16(height))
+	buf.Write([]byte{0x80, 0, 0})                // 全局颜色表 2 色
+	buf.Write([]byte{0, 0, 0, 0xFF, 0xFF, 0xFF}) // 黑、白
+	for i := 0; i < frames; i++ {
+		buf.Write(gifFrame)
+	}
+	buf.WriteByte(0x3B)
+	return buf.Bytes()
+}
+
+func TestScanGIF(t *testing.T) {
+	valid := buildGIF(4, 3, 3)
+	gif87 := append([]byte("GIF87a"), valid[6:]...)
+	header := len(valid) - 1 - 3*len(gifFrame) // 文件头 + 全局颜色表
+
+	// 帧超出画布: 描述符宽度改为 5
+	outOfBounds := append([]byte(nil), valid...)
+	outOfBounds[header+8+5] = 5
+	// 帧偏移超出画布: left = 65535
+	offsetOverflow := append([]byte(nil), valid...)
+	offsetOverflow[header+8+1], offsetOverflow[header+8+2] = 0xFF, 0xFF
+	// 未知块类型
+	unknownBlock := append(append([]byte(nil), valid[:header]...), 0x99)
+	// 全局颜色表声明 256 色但文件在此结束
+	hugeColorTable := append([]byte(nil), valid[:13]...)
+	hugeColorTable[10] = 0x87
+	// 局部颜色表声明 256 色但文件在此结束
+	localColorTable := append([]byte(nil), valid[:header+8+10]...)
+	localColorTable[header+8+9] = 0x87
+	// 数据子块长度超出文件
+	longSubBlock := append(append([]byte(nil), valid[:header+8+10]...), 0x02, 0xFF, 0x01)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    bool
+		wantFrames int
+	}{
+		{"GIF89a", valid, false, 3},
+		{"GIF87a", gif87, false, 3},
+		{"空文件", nil, true, 0},
+		{"只有签名", []byte("GIF89a"), true, 0},
+		{"不是 GIF", append([]byte("PNG89a"), valid[6:]...), true, 0},
+		{"没有帧", buildGIF(4, 3, 0), false, 0},
+		{"缺少结束符", valid[:len(valid)-1], false, 3},
+		{"截断在第二帧描述符中", valid[:header+len(gifFrame)+8+4], false, 1},
+		{"截断在 LZW 数据中", valid[:header+len(gifFrame)-2], false, 1},
+		{"帧超出画布", outOfBounds, true, 0},
+		{"帧偏移超出画布", offsetOverflow, true, 0},
+		{"未知块类型", unknownBlock, true, 0},
+		{"全局颜色表超出文件", hugeColorTable, false, 0},
+		{"局部颜色表超出文件", localColorTable, false, 1},
+		{"数据子块超出文件", longSubBlock, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := scanGIF(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("scanGIF succeeded with %d frames, want error", info.frames)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scanGIF error: %v", err)
+			}
+			if info.frames != tt.wantFrames {
+				t.Errorf("frames = %d, want %d", info.frames, tt.wantFrames)
+			}
+			if info.width != 4 || info.height != 3 {
+				t.Errorf("size = %dx%d, want 4x3", info.width, info.height)
+			}
+		})
+	}
+}
+
+// 任意位置截断都不能越界访问
+func TestScanGIFTruncated(t *testing.T) {
+	data := buildGIF(4, 3, 2)
+	for i := range data {
+		scanGIF(data[:i])
+	}
+}
+
+func TestScanGIFDeclaredSize(t *testing.T) {
+	info, err := scanGIF(buildGIF(65535, 65535, 1))
+	if err != nil {
+		t.Fatalf("scanGIF error: %v", err)
+	}
+	if info.width != 65535 || info.height != 65535 || info.frames != 1 {
+		t.Errorf("scanGIF = %dx%d, %d frames; want 65535x65535, 1 frame", info.width, info.height, info.frames)
+	}
+}
+
+func TestCheckAnimationSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		frames        int
+		maxFrames     int
+		maxTotalMP    float64
+		wantErr       error
+	}{
+		{"未超过限制", 100, 100, 10, 300, 100, nil},
+		{"帧数等于上限", 1, 1, 300, 300, 100, nil},
+		{"帧数超过上限", 1, 1, 301, 300, 100, ErrTooManyFrames},
+		{"不限制帧数", 1, 1, 100000, 0, 100, nil},
+		{"总像素等于上限", 1000, 1000, 100, 0, 100, nil},
+		{"总像素超过上限", 5000, 5000, 5, 300, 100, ErrImageTooLarge},
+		{"不限制总像素", 5000, 5000, 300, 300, 0, nil},
+		{"帧数优先报告", 5000, 5000, 301, 300, 100, ErrTooManyFrames},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAnimationSize(tt.width, tt.height, tt.frames, tt.maxFrames, tt.maxTotalMP)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("checkAnimationSize error = %v, want %v", err, tt.wantErr)
+			}
+			var tooLarge *ImageTooLargeError
+			if errors.As(err, &tooLarge) && tooLarge.Frames != tt.frames {
+				t.Errorf("ImageTooLargeError.Frames = %d, want %d", tooLarge.Frames, tt.frames)
+			}
+		})
+	}
+}
+
+func TestDecodeGIFAnimation(t *testing.T) {
+	anim, err := decodeGIFAnimation(buildGIF(4, 3, 3), 300, 100)
+	if err != nil {
+		t.Fatalf("decodeGIFAnimation error: %v", err)
+	}
+	if len(anim.Frames) != 3 || anim.Width != 4 || anim.Height != 3 {
+		t.Errorf("got %d frames of %dx%d, want 3 frames of 4x3", len(anim.Frames), anim.Width, anim.Height)
+	}
+
+	// 超过 max_frames
+	if _, err := decodeGIFAnimation(buildGIF(4, 3, 301), 300, 100); !errors.Is(err, ErrTooManyFrames) {
+		t.Errorf("301 frames: error = %v, want ErrTooManyFrames", err)
+	}
+
+	// 画布 65535×65535 的单帧 GIF 在分配画布前被拒绝
+	if _, err := decodeGIFAnimation(buildGIF(65535, 65535, 1), 300, 100); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("65535x65535 canvas: error = %v, want ErrImageTooLarge", err)
+	}
+
+	if _, err := decodeGIFAnimation(buildGIF(4, 3, 0), 300, 100); err == nil {
+		t.Error("GIF without frames decoded without error")
+	}
+}
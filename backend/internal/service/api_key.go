@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"image-hosting/internal/model"
+)
+
+// API Key 相关错误
+var (
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrInvalidAPIKey   = errors.New("invalid api key request")
+	ErrAPIKeysDisabled = errors.New("api keys are disabled")
+)
+
+// apiKeyPrefix API Key 前缀，格式为 ihk_{id}_{secret}
+const apiKeyPrefix = "ihk_"
+
+// lastUsedInterval 最后使用时间的更新间隔，避免每次请求都写文件
+const lastUsedInterval = time.Minute
+
+// apiKeyRecord 保存在 auth.keys_file 中的 API Key
+// 只保存 secret 的加盐 SHA-256，secret 为 32 字节随机数，不需要慢哈希
+type apiKeyRecord struct {
+	model.APIKey
+	Salt string `json:"salt"`
+	Hash string `json:"hash"`
+}
+
+// APIKeyOptions 创建 API Key 的参数
+type APIKeyOptions struct {
+	Name      string
+	Username  string       // 所属用户，必须是 auth.users 中的用户
+	Scopes    []string     // 权限范围，不能超出用户角色拥有的权限
+	ExpiresAt *time.Time   // 过期时间，为空表示不过期
+	Quota     *model.Quota // 使用该 Key 上传的配额，为空表示不限制
+}
+
+// KeysEnabled 是否支持通过接口管理 API Key (启用鉴权并配置了 auth.keys_file)
+func (s *AccountService) KeysEnabled() bool {
+	return s.keysPath != ""
+}
+
+// CreateKey 创建 API Key
+// 返回结果中包含完整的 Key，之后无法再次获取
+func (s *AccountService) CreateKey(ctx context.Context, opts APIKeyOptions) (*model.CreatedAPIKey, error) {
+	if !s.KeysEnabled() {
+		return nil, ErrAPIKeysDisabled
+	}
+
+	if opts.Username == "" {
+		return nil, fmt.Errorf("%w: username is required", ErrInvalidAPIKey)
+	}
+	a, ok := s.accounts[opts.Username]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown user %q", ErrInvalidAPIKey, opts.Username)
+	}
+	scopes, err := checkScopes(opts.Scopes, a.user.Role)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at is in the past", ErrInvalidAPIKey)
+	}
+	if q := opts.Quota; q != nil && (q.MaxBytes < 0 || q.MaxImages < 0 || q.MaxUploadsPerDay < 0) {
+		return nil, fmt.Errorf("%w: quota must not be negative", ErrInvalidAPIKey)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &apiKeyRecord{
+		APIKey: model.APIKey{
+			ID:        id,
+			Name:      opts.Name,
+			Prefix:    apiKeyPrefix + id,
+			Username:  opts.Username,
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: opts.ExpiresAt,
+			Quota:     opts.Quota,
+		},
+		Salt: salt,
+		Hash: hashSecret(salt, secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[id] = record
+	if err := s.saveKeysLocked(); err != nil {
+		delete(s.keys, id)
+		return nil, err
+	}
+
+	return &model.CreatedAPIKey{
+		APIKey: record.APIKey,
+		Key:    record.Prefix + "_" + secret,
+	}, nil
+}
+
+// ListKeys 按创建时间倒序列出全部 API Key，包括已过期和已吊销的
+func (s *AccountService) ListKeys(ctx context.Context) ([]model.APIKey, error) {
+	if !s.KeysEnabled() {
+		return nil, ErrAPIKeysDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]model.APIKey, 0, len(s.keys))
+	for _, r := range s.keys {
+		keys = append(keys, r.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// RevokeKey 吊销 API Key，吊销后立即失效
+// 记录保留在列表中；重复吊销不报错
+func (s *AccountService) RevokeKey(ctx context.Context, id string) (*model.APIKey, error) {
+	if !s.KeysEnabled() {
+		return nil, ErrAPIKeysDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	if record.RevokedAt == nil {
+		now := time.Now()
+		record.RevokedAt = &now
+		if err := s.saveKeysLocked(); err != nil {
+			record.RevokedAt = nil
+			return nil, err
+		}
+	}
+
+	key := record.APIKey
+	return &key, nil
+}
+
+// authenticateKey 验证 API Key，返回所属用户
+// 用户的权限为 Key 的权限与用户角色权限的交集，用户从配置中删除后 Key 随之失效
+func (s *AccountService) authenticateKey(token string) *model.User {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), "_")
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.keys[id]
+	if !ok || record.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(record.Salt, secret)), []byte(record.Hash)) != 1 {
+		return nil
+	}
+	a, ok := s.accounts[record.Username]
+	if !ok {
+		return nil
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedInterval {
+		record.LastUsedAt = &now
+		if err := s.saveKeysLocked(); err != nil {
+			log.Printf("[WARN] failed to save api key last used time: %v", err)
+		}
+	}
+
+	var scopes []string
+	for _, scope := range record.Scopes {
+		if a.user.HasScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &model.User{Username: a.user.Username, Role: a.user.Role, Scopes: scopes, KeyID: record.ID}
+}
+
+// checkScopes 校验并去重权限范围
+func checkScopes(scopes []string, role string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: scopes is required", ErrInvalidAPIKey)
+	}
+
+	allowed := &model.User{Role: role, Scopes: roleScopes(role)}
+	result := make([]string, 0, len(scopes))
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		switch scope {
+		case model.ScopeUpload, model.ScopeRead, model.ScopeDelete, model.ScopeAdmin:
+		default:
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+		if !allowed.HasScope(scope) {
+			return nil, fmt.Errorf("%w: scope %q is not allowed for role %q", ErrInvalidAPIKey, scope, role)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// loadKeys 读取 auth.keys_file，文件不存在时视为没有 API Key
+func (s *AccountService) loadKeys() error {
+	if !s.KeysEnabled() {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.keysPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []*apiKeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		s.keys[r.ID] = r
+	}
+	return nil
+}
+
+// saveKeysLocked 原子保存全部 API Key，调用前需持有 mu
+func (s *AccountService) saveKeysLocked() error {
+	records := make([]*apiKeyRecord, 0, len(s.keys))
+	for _, r := range s.keys {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.keysPath), 0755); err != nil {
+		return err
+	}
+	// 文件中虽然只有哈希，仍只允许服务自身读取
+	tmpFile := s.keysPath + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, s.keysPath); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+// hashSecret 计算加盐哈希
+func hashSecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex 生成 n 字节随机数的十六进制表示
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
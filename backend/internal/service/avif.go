@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"image-hosting/internal/config"
+)
+
+// ErrAVIFUnavailable 未找到 AVIF 编解码程序
+var ErrAVIFUnavailable = errors.New("avif codec is not available")
+
+// AVIFCodec AVIF 编解码器
+// 通过调用 libavif 提供的 avifenc / avifdec 命令实现 (需要 libavif >= 1.0)
+// 图片以 PNG 格式与外部程序交换，临时文件在调用结束后删除
+type AVIFCodec struct {
+	encoderPath string
+	decoderPath string
+	quality     int
+	speed       int
+	timeout     time.Duration
+}
+
+// NewAVIFCodec 创建 AVIF 编解码器
+// 编码程序不存在时返回 ErrAVIFUnavailable；解码程序可选，不存在时无法读取 AVIF 原图
+func NewAVIFCodec(cfg *config.AVIFConfig) (*AVIFCodec, error) {
+	encoderPath, err := exec.LookPath(cfg.EncoderPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAVIFUnavailable, err)
+	}
+
+	decoderPath, err := exec.LookPath(cfg.DecoderPath)
+	if err != nil {
+		decoderPath = ""
+	}
+
+	quality := cfg.Quality
+	if quality < 1 || quality > 100 {
+		quality = 60
+	}
+	speed := cfg.Speed
+	if speed < 0 || speed > 10 {
+		speed = 6
+	}
+	timeout := time.Duration(cfg.TimeoutSecs) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	return &AVIFCodec{
+		encoderPath: encoderPath,
+		decoderPath: decoderPath,
+		quality:     quality,
+		speed:       speed,
+		timeout:     timeout,
+	}, nil
+}
+
+// CanDecode 是否可以解码 AVIF 图片
+func (c *AVIFCodec) CanDecode() bool {
+	return c.decoderPath != ""
+}
+
+// Encode 将图片编码为 AVIF
+// quality 为 0 时使用配置的默认质量
+func (c *AVIFCodec) Encode(img image.Image, quality int) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		quality = c.quality
+	}
+
+	dir, err := os.MkdirTemp("", "avif-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.png")
+	output := filepath.Join(dir, "output.avif")
+
+	// 中间文件只需无损，压缩率无关紧要
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(input, buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+
+	if err := c.run(c.encoderPath,
+		"-q", strconv.Itoa(quality),
+		"-s", strconv.Itoa(c.speed),
+		input, output,
+	); err != nil {
+		return nil, fmt.Errorf("avifenc: %w", err)
+	}
+
+	return os.ReadFile(output)
+}
+
+// Decode 解码 AVIF 图片
+func (c *AVIFCodec) Decode(data []byte) (image.Image, error) {
+	if !c.CanDecode() {
+		return nil, fmt.Errorf("%w: decoder not found", ErrAVIFUnavailable)
+	}
+
+	dir, err := os.MkdirTemp("", "avif-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.avif")
+	output := filepath.Join(dir, "output.png")
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+
+	if err := c.run(c.decoderPath, input, output); err != nil {
+		return nil, fmt.Errorf("avifdec: %w", err)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// run 执行外部命令，超时后强制结束
+// 出错时附带命令的标准错误输出，便于排查
+func (c *AVIFCodec) run(name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// avifDimensions 读取 AVIF 中声明的图片尺寸
+// 取所有 ispe (图像空间尺寸) 属性中的最大值，网格图片的整体尺寸与各分块均会计入
+// ispe 格式: 大小 (4) + "ispe" + 版本与标志 (4) + 宽 (4, 大端) + 高 (4, 大端)
+func avifDimensions(data []byte) (int, int, error) {
+	var width, height int
+	found := false
+	for rest := data; ; {
+		i := bytes.Index(rest, []byte("ispe"))
+		if i < 0 || i+16 > len(rest) {
+			break
+		}
+		box := rest[i+8 : i+16]
+		width = max(width, int(binary.BigEndian.Uint32(box[0:4])))
+		height = max(height, int(binary.BigEndian.Uint32(box[4:8])))
+		found = true
+		rest = rest[i+4:]
+	}
+	if !found {
+		return 0, 0, errors.New("avif: missing image size (ispe)")
+	}
+	return width, height, nil
+}
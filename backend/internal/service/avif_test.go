@@ -0,0 +1,61 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// ispeBox 生成 ispe 属性: 大小 (4) + "ispe" + 版本与标志 (4) + 宽 (4) + 高 (4)
+func ispeBox(width, height uint32) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint32(b[0:4], 20)
+	copy(b[4:8], "ispe")
+	binary.BigEndian.PutUint32(b[12:16], width)
+	binary.BigEndian.PutUint32(b[16:20], height)
+	return b
+}
+
+// avifWithBoxes 生成带 ftyp 的 AVIF 文件头，之后依次拼接 boxes
+func avifWithBoxes(boxes ...[]byte) []byte {
+	ftyp := []byte("\x00\x00\x00\x14ftypavif\x00\x00\x00\x00avif")
+	return append(ftyp, bytes.Join(boxes, nil)...)
+}
+
+func TestAVIFDimensions(t *testing.T) {
+	tests := []struct {
+		name                  string
+		data                  []byte
+		wantWidth, wantHeight int
+		wantErr               bool
+	}{
+		{"单个 ispe", avifWithBoxes(ispeBox(640, 480)), 640, 480, false},
+		{"网格图片取最大值", avifWithBoxes(ispeBox(512, 512), ispeBox(2048, 1536), ispeBox(512, 512)), 2048, 1536, false},
+		{"宽高分别取最大值", avifWithBoxes(ispeBox(100, 900), ispeBox(800, 200)), 800, 900, false},
+		{"声明 50000x50000", avifWithBoxes(ispeBox(50000, 50000)), 50000, 50000, false},
+		{"声明最大 32 位尺寸", avifWithBoxes(ispeBox(0xFFFFFFFF, 1)), 0xFFFFFFFF, 1, false},
+		{"缺少 ispe", avifWithBoxes(), 0, 0, true},
+		{"空文件", nil, 0, 0, true},
+		{"ispe 被截断", avifWithBoxes(ispeBox(640, 480)[:18]), 0, 0, true},
+		{"完整 ispe 后跟截断的 ispe", avifWithBoxes(ispeBox(640, 480), ispeBox(9999, 9999)[:12]), 640, 480, false},
+		{"只有 ispe 标识", []byte("ispe"), 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, err := avifDimensions(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("avifDimensions = %dx%d, want error", w, h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("avifDimensions error: %v", err)
+			}
+			if w != tt.wantWidth || h != tt.wantHeight {
+				t.Errorf("avifDimensions = %dx%d, want %dx%d", w, h, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"image-hosting/internal/model"
+)
+
+// BatchFile 批量上传中的单个文件
+// Open 在开始处理时才调用，同一时间只打开正在处理的文件
+type BatchFile struct {
+	Name string                        // 客户端提供的文件名
+	Size int64                         // 文件大小
+	Open func() (io.ReadCloser, error) // 打开文件内容
+}
+
+// BatchResult 批量上传中单个文件的处理结果
+// Err 不为 nil 时表示该文件失败，不影响其他文件
+type BatchResult struct {
+	Result *model.UploadResult
+	Err    error
+}
+
+// defaultMaxBatchFiles image.batch.max_files 未配置时单次请求最多文件数
+const defaultMaxBatchFiles = 20
+
+// CheckBatch 检查批量上传的文件数与上传参数
+// 不满足时整个请求失败，不处理任何文件
+func (s *ImageService) CheckBatch(count int, opts UploadOptions) error {
+	if maxFiles := s.MaxBatchFiles(); count > maxFiles {
+		return &TooManyFilesError{Count: count, MaxFiles: maxFiles}
+	}
+	return s.ValidateOptions(opts)
+}
+
+// UploadBatch 批量上传图片
+// 同时处理的文件数不超过 image.batch.concurrency，结果与 files 顺序一致；
+// 单个文件失败只记录在对应结果中，客户端断开后未开始的文件不再处理
+func (s *ImageService) UploadBatch(ctx context.Context, files []BatchFile, opts UploadOptions) ([]BatchResult, error) {
+	if err := s.CheckBatch(len(files), opts); err != nil {
+		return nil, err
+	}
+
+	concurrency := s.config.Image.Batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]BatchResult, len(files))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, f := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, f BatchFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i].Result, results[i].Err = s.uploadBatchFile(ctx, f, opts)
+		}(i, f)
+	}
+
+	wg.Wait()
+	return results, nil
+}
+
+// uploadBatchFile 处理批量上传中的单个文件
+func (s *ImageService) uploadBatchFile(ctx context.Context, f BatchFile, opts UploadOptions) (*model.UploadResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return s.Upload(ctx, file, f.Size, opts)
+}
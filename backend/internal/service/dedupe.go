@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"image-hosting/internal/model"
+)
+
+// sha256Hex 计算 SHA-256 十六进制摘要
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// refCount 返回图片的有效引用计数
+// 启用去重之前上传的图片没有记录引用计数，视为 1
+func refCount(img *model.Image) int {
+	if img.RefCount < 1 {
+		return 1
+	}
+	return img.RefCount
+}
+
+// acquireDuplicate 查找 ownerID 上传的、输出格式为 format、可见性为 visibility 且与任一哈希相同的已有图片，找到时引用计数加一
+// 同一张原图以不同格式上传时各自保存，互不视为重复；不同用户上传的图片各自保存，互不可见；
+// 公开与私有的图片各自保存，私有上传不会返回可公开访问的图片
+// 未找到时返回 nil, nil
+func (s *ImageService) acquireDuplicate(ctx context.Context, ownerID, format, visibility string, hashes ...string) (*model.Image, error) {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+
+	return s.acquireDuplicateLocked(ctx, ownerID, format, visibility, hashes...)
+}
+
+// acquireDuplicateLocked 同 acquireDuplicate，调用前需持有 refMu
+func (s *ImageService) acquireDuplicateLocked(ctx context.Context, ownerID, format, visibility string, hashes ...string) (*model.Image, error) {
+	for _, hash := range hashes {
+		existing, err := s.metadata.FindByHash(ctx, hash, format, ownerID, visibility)
+		if errors.Is(err, ErrMetadataNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find duplicate: %w", err)
+		}
+
+		existing.RefCount = refCount(existing) + 1
+		if err := s.metadata.Add(ctx, existing); err != nil {
+			return nil, fmt.Errorf("failed to save metadata: %w", err)
+		}
+		return existing, nil
+	}
+	return nil, nil
+}
+
+// addImage 保存新图片的元数据
+// 启用去重时，在同一把锁内再次检查重复，防止并发上传相同内容产生两条记录
+// 返回值不为 nil 表示并发上传已先行保存了相同内容，调用方应丢弃自己生成的文件
+// 新图片在保存元数据前计入配额，超出占用空间配额时返回 *QuotaExceededError
+func (s *ImageService) addImage(ctx context.Context, img *model.Image, quota *quotaReservation) (*model.Image, error) {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+
+	if s.config.Image.Dedupe {
+		existing, err := s.acquireDuplicateLocked(ctx, img.OwnerID, img.Format, imageVisibility(img), img.ContentHash, img.ProcessedHash)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			quota.commitDuplicate()
+			return existing, nil
+		}
+	}
+
+	size := storedSize(img)
+	if err := quota.commitImage(size); err != nil {
+		return nil, err
+	}
+
+	img.RefCount = 1
+	if err := s.metadata.Add(ctx, img); err != nil {
+		quota.rollbackImage(size)
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil, nil
+}
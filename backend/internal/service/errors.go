@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 图片服务错误
+// 调用方使用 errors.Is 判断错误类别，使用 errors.As 获取具体错误类型中的详情
+var (
+	// ErrInvalidFileType 文件类型不在允许列表内，具体类型见 *InvalidFileTypeError
+	ErrInvalidFileType = errors.New("invalid file type")
+
+	// ErrFileTooLarge 文件超过大小限制，具体大小见 *FileTooLargeError
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrProcessingFailed 图片解码、缩放或编码失败
+	ErrProcessingFailed = errors.New("failed to process image")
+
+	// ErrStorageFailed 存储读写失败，具体操作见 *StorageError
+	ErrStorageFailed = errors.New("storage operation failed")
+
+	// ErrImageNotFound 图片不存在
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrOriginalNotFound 图片上传时未保存原图
+	ErrOriginalNotFound = errors.New("original not found")
+
+	// ErrUnsupportedFormat 不支持的输出格式
+	ErrUnsupportedFormat = errors.New("unsupported output format")
+
+	// ErrImageTooLarge 图片像素尺寸超过限制，具体尺寸见 *ImageTooLargeError
+	ErrImageTooLarge = errors.New("image dimensions too large")
+
+	// ErrServerBusy 处理队列已满，具体重试间隔见 *ServerBusyError
+	ErrServerBusy = errors.New("server busy")
+
+	// ErrTooManyFrames 动图帧数超过 image.animation.max_frames
+	ErrTooManyFrames = errors.New("too many animation frames")
+
+	// ErrInvalidWatermark 上传时指定的水印参数无效
+	ErrInvalidWatermark = errors.New("invalid watermark options")
+
+	// ErrTooManyFiles 批量上传的文件数超过限制，具体数量见 *TooManyFilesError
+	ErrTooManyFiles = errors.New("too many files")
+
+	// ErrInvalidRemoteURL 远程图片地址无效 (仅支持 http / https)
+	ErrInvalidRemoteURL = errors.New("invalid remote url")
+
+	// ErrRemoteURLBlocked 远程图片地址指向内网等禁止访问的地址
+	ErrRemoteURLBlocked = errors.New("remote address not allowed")
+
+	// ErrRemoteFetchFailed 远程图片下载失败，具体原因见 *RemoteFetchError
+	ErrRemoteFetchFailed = errors.New("failed to fetch remote image")
+
+	// ErrQuotaExceeded 超出用户或 API Key 的配额，具体配额见 *QuotaExceededError
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// InvalidFileTypeError 文件类型不允许
+type InvalidFileTypeError struct {
+	MimeType     string   // 检测到的 MIME 类型
+	AllowedTypes []string // 允许的 MIME 类型
+}
+
+func (e *InvalidFileTypeError) Error() string {
+	return fmt.Sprintf("invalid file type: %s", e.MimeType)
+}
+
+// Is 使 errors.Is(err, ErrInvalidFileType) 成立
+func (e *InvalidFileTypeError) Is(target error) bool {
+	return target == ErrInvalidFileType
+}
+
+// FileTooLargeError 文件超过大小限制
+type FileTooLargeError struct {
+	Size    int64 // 文件大小 (bytes)
+	MaxSize int64 // 允许的最大大小 (bytes)
+}
+
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("file too large: %d bytes (max: %d)", e.Size, e.MaxSize)
+}
+
+// Is 使 errors.Is(err, ErrFileTooLarge) 成立
+func (e *FileTooLargeError) Is(target error) bool {
+	return target == ErrFileTooLarge
+}
+
+// ImageTooLargeError 图片像素尺寸超过限制
+// 在完整解码前根据文件头中声明的尺寸判断
+type ImageTooLargeError struct {
+	Width         int     // 图片宽度
+	Height        int     // 图片高度
+	MaxWidth      int     // 允许的最大宽度，0 表示不限制
+	MaxHeight     int     // 允许的最大高度，0 表示不限制
+	MaxMegapixels float64 // 允许的最大像素数 (百万)，0 表示不限制
+
+	// 动图全部帧的总像素数超过限制时设置
+	Frames             int     // 帧数
+	MaxTotalMegapixels float64 // 允许的总像素数 (百万)
+}
+
+func (e *ImageTooLargeError) Error() string {
+	if e.Frames > 0 {
+		return fmt.Sprintf("animation too large: %dx%d x %d frames (max: %gMP in total)",
+			e.Width, e.Height, e.Frames, e.MaxTotalMegapixels)
+	}
+	return fmt.Sprintf("image dimensions too large: %dx%d (max: %dx%d, %gMP)",
+		e.Width, e.Height, e.MaxWidth, e.MaxHeight, e.MaxMegapixels)
+}
+
+// Is 使 errors.Is(err, ErrImageTooLarge) 成立
+func (e *ImageTooLargeError) Is(target error) bool {
+	return target == ErrImageTooLarge
+}
+
+// ServerBusyError 处理队列已满
+type ServerBusyError struct {
+	RetryAfter time.Duration // 建议的重试间隔
+}
+
+func (e *ServerBusyError) Error() string {
+	return fmt.Sprintf("server busy, retry after %s", e.RetryAfter)
+}
+
+// Is 使 errors.Is(err, ErrServerBusy) 成立
+func (e *ServerBusyError) Is(target error) bool {
+	return target == ErrServerBusy
+}
+
+// TooManyFilesError 批量上传的文件数超过 image.batch.max_files
+type TooManyFilesError struct {
+	Count    int // 请求中的文件数
+	MaxFiles int // 允许的最大文件数
+}
+
+func (e *TooManyFilesError) Error() string {
+	return fmt.Sprintf("too many files: %d (max: %d)", e.Count, e.MaxFiles)
+}
+
+// Is 使 errors.Is(err, ErrTooManyFiles) 成立
+func (e *TooManyFilesError) Is(target error) bool {
+	return target == ErrTooManyFiles
+}
+
+// RemoteFetchError 远程图片下载失败
+// 连接失败或超时时 StatusCode 为 0
+type RemoteFetchError struct {
+	URL        string // 请求地址 (不含密码)
+	StatusCode int    // 远程服务器返回的 HTTP 状态码
+	Err        error  // 网络错误
+}
+
+func (e *RemoteFetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", ErrRemoteFetchFailed, e.Err)
+	}
+	return fmt.Sprintf("%v: %s returned HTTP %d", ErrRemoteFetchFailed, e.URL, e.StatusCode)
+}
+
+func (e *RemoteFetchError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, ErrRemoteFetchFailed) 成立
+func (e *RemoteFetchError) Is(target error) bool {
+	return target == ErrRemoteFetchFailed
+}
+
+// StorageError 存储操作失败
+type StorageError struct {
+	Op  string // 操作: save / open / delete
+	Err error  // 存储层返回的原始错误
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("failed to %s file: %v", e.Op, e.Err)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, ErrStorageFailed) 成立
+func (e *StorageError) Is(target error) bool {
+	return target == ErrStorageFailed
+}
+
+// VariantNotAllowedError 变体参数不在允许列表内
+type VariantNotAllowedError struct {
+	Param string // 参数名: w / h / q / fmt / fit
+	Value string // 请求的参数值
+}
+
+func (e *VariantNotAllowedError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%v: %s", ErrVariantNotAllowed, e.Param)
+	}
+	return fmt.Sprintf("%v: %s=%s", ErrVariantNotAllowed, e.Param, e.Value)
+}
+
+// Is 使 errors.Is(err, ErrVariantNotAllowed) 成立
+func (e *VariantNotAllowedError) Is(target error) bool {
+	return target == ErrVariantNotAllowed
+}
+
+// processingError 包装图片处理错误，保留原始错误信息
+func processingError(err error) error {
+	return fmt.Errorf("%w: %w", ErrProcessingFailed, err)
+}
+
+// QuotaExceededError 超出配额
+type QuotaExceededError struct {
+	Subject string // 配额所属: user / key
+	Limit   string // 超出的配额: bytes / images / uploads_per_day
+	Used    int64  // 已使用量 (bytes 时包括本次上传)
+	Max     int64  // 配额
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %s %d (max: %d)", e.Subject, e.Limit, e.Used, e.Max)
+}
+
+// Is 使 errors.Is(err, ErrQuotaExceeded) 成立
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"image-hosting/internal/model"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// EXIF 保留策略
+const (
+	ExifKeep     = "keep"      // 保留全部拍摄信息，包括 GPS 位置
+	ExifStripGPS = "strip_gps" // 删除 GPS 位置
+	ExifStripAll = "strip_all" // 不保留任何拍摄信息
+)
+
+// exifTimeLayout EXIF 中的时间格式
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// validateExifPolicy 检查 EXIF 保留策略
+func validateExifPolicy(policy string) error {
+	switch policy {
+	case ExifKeep, ExifStripGPS, ExifStripAll:
+		return nil
+	default:
+		return fmt.Errorf("invalid exif policy: %q", policy)
+	}
+}
+
+// applyExifPolicy 按策略过滤拍摄信息
+// 返回新的对象，不修改传入的 info；策略变严后，已保存的信息同样按新策略过滤
+func applyExifPolicy(info *model.Exif, policy string) *model.Exif {
+	if info == nil || policy == ExifStripAll {
+		return nil
+	}
+
+	filtered := *info
+	if policy != ExifKeep {
+		filtered.GPS = nil
+	}
+	if filtered == (model.Exif{}) {
+		return nil
+	}
+	return &filtered
+}
+
+// extractExif 从原图中提取拍摄信息
+// 支持 JPEG (APP1)、PNG (eXIf 块) 与 WebP (EXIF 块)，无 EXIF 或解析失败时返回 nil
+func extractExif(data []byte, mimeType string) *model.Exif {
+	payload := exifPayload(data, mimeType)
+	if payload == nil {
+		return nil
+	}
+
+	x, err := exif.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return nil
+	}
+
+	info := &model.Exif{
+		Make:        exifString(x, exif.Make),
+		Model:       exifString(x, exif.Model),
+		LensModel:   exifString(x, exif.LensModel),
+		FNumber:     exifFloat(x, exif.FNumber),
+		FocalLength: exifFloat(x, exif.FocalLength),
+	}
+
+	// 时间不含时区，按原样输出，避免被当作服务器时区
+	if taken := exifString(x, exif.DateTimeOriginal); taken != "" {
+		if t, err := time.Parse(exifTimeLayout, taken); err == nil {
+			info.TakenAt = t.Format("2006-01-02T15:04:05")
+		}
+	}
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if r, err := tag.Rat(0); err == nil && r.Sign() > 0 {
+			// 快门速度习惯写作 1/125，长曝光写作 2 或 0.5
+			if !r.IsInt() && r.Num().Int64() == 1 {
+				info.ExposureTime = r.String()
+			} else {
+				info.ExposureTime = strings.TrimSuffix(strings.TrimRight(r.FloatString(2), "0"), ".")
+			}
+		}
+	}
+
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		if iso, err := tag.Int(0); err == nil {
+			info.ISO = iso
+		}
+	}
+
+	if lat, lng, err := x.LatLong(); err == nil && !math.IsNaN(lat) && !math.IsNaN(lng) {
+		gps := &model.GPS{Latitude: lat, Longitude: lng}
+		if alt := exifFloat(x, exif.GPSAltitude); alt != 0 {
+			// GPSAltitudeRef 为 1 表示海平面以下
+			if tag, err := x.Get(exif.GPSAltitudeRef); err == nil {
+				if ref, err := tag.Int(0); err == nil && ref == 1 {
+					alt = -alt
+				}
+			}
+			gps.Altitude = &alt
+		}
+		info.GPS = gps
+	}
+
+	if *info == (model.Exif{}) {
+		return nil
+	}
+	return info
+}
+
+// exifPayload 取出图片中的 EXIF 数据
+// JPEG 交给 goexif 查找 APP1 段，PNG / WebP 取出对应数据块 (TIFF 格式)
+func exifPayload(data []byte, mimeType string) []byte {
+	switch mimeType {
+	case "image/jpeg":
+		return data
+	case "image/png":
+		return pngChunk(data, "eXIf")
+	case "image/webp":
+		chunks, err := parseRIFFChunks(data)
+		if err != nil {
+			return nil
+		}
+		for _, c := range chunks {
+			if c.fourCC == "EXIF" {
+				return c.data
+			}
+		}
+	}
+	return nil
+}
+
+// pngChunk 查找 PNG 中指定类型的数据块
+// 块格式: 长度 (4, 大端) + 类型 (4) + 数据 + CRC (4)
+func pngChunk(data []byte, chunkType string) []byte {
+	const signatureLen = 8
+	if len(data) < signatureLen || string(data[1:4]) != "PNG" {
+		return nil
+	}
+
+	data = data[signatureLen:]
+	for len(data) >= 12 {
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		if size < 0 || size > len(data)-12 {
+			return nil
+		}
+		typ := string(data[4:8])
+		if typ == chunkType {
+			return data[8 : 8+size]
+		}
+		if typ == "IEND" {
+			return nil
+		}
+		data = data[12+size:]
+	}
+	return nil
+}
+
+// exifString 读取字符串字段，去除首尾空白
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// exifFloat 读取有理数字段
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	r, err := tag.Rat(0)
+	if err != nil {
+		return 0
+	}
+	f, _ := r.Float64()
+	return math.Round(f*100) / 100
+}
+
+// stripWebPMetadata 删除 WebP 中的 EXIF 与 XMP 数据块
+// 原样保存的动画 WebP 不经过重新编码，需要单独删除元数据
+func stripWebPMetadata(data []byte) []byte {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil || len(chunks) == 0 || chunks[0].fourCC != "VP8X" {
+		return data // 简单格式 (VP8 / VP8L) 不能携带元数据
+	}
+
+	var body bytes.Buffer
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			header := append([]byte(nil), c.data...)
+			header[0] &^= vp8xFlagEXIF | vp8xFlagXMP
+			appendChunk(&body, c.fourCC, header)
+		default:
+			appendChunk(&body, c.fourCC, c.data)
+		}
+	}
+	return wrapRIFF(body.Bytes())
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// pngSignature PNG 文件签名
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunkBytes 生成 PNG 数据块: 长度 (4) + 类型 (4) + 数据 + CRC (4)
+func pngChunkBytes(typ string, data []byte) []byte {
+	b := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(data)))
+	copy(b[4:8], typ)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+// buildPNG 拼接 PNG 签名与数据块
+func buildPNG(chunks ...[]byte) []byte {
+	return append([]byte(pngSignature), bytes.Join(chunks, nil)...)
+}
+
+// pngIHDR 生成声明 width×height、8 位 RGBA 的 IHDR 块
+func pngIHDR(width, height uint32) []byte {
+	data := make([]byte, 13)
+	binary.BigEndian.PutUint32(data[0:4], width)
+	binary.BigEndian.PutUint32(data[4:8], height)
+	data[8], data[9] = 8, 6
+	return pngChunkBytes("IHDR", data)
+}
+
+func TestPNGChunk(t *testing.T) {
+	exifData := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ihdr := pngIHDR(1, 1)
+	iend := pngChunkBytes("IEND", nil)
+
+	// 长度字段超出文件
+	oversized := pngChunkBytes("eXIf", exifData)
+	binary.BigEndian.PutUint32(oversized[0:4], 1<<20)
+	// 长度字段为 0xFFFFFFFF
+	maxLength := pngChunkBytes("eXIf", exifData)
+	binary.BigEndian.PutUint32(maxLength[0:4], 0xFFFFFFFF)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"包含 eXIf", buildPNG(ihdr, pngChunkBytes("eXIf", exifData), iend), exifData},
+		{"eXIf 在其他块之后", buildPNG(ihdr, pngChunkBytes("tEXt", []byte("a\x00b")), pngChunkBytes("eXIf", exifData), iend), exifData},
+		{"空 eXIf", buildPNG(ihdr, pngChunkBytes("eXIf", nil), iend), []byte{}},
+		{"没有 eXIf", buildPNG(ihdr, iend), nil},
+		{"IEND 之后的块被忽略", buildPNG(ihdr, iend, pngChunkBytes("eXIf", exifData)), nil},
+		{"长度超出文件", buildPNG(ihdr, oversized), nil},
+		{"长度为 0xFFFFFFFF", buildPNG(ihdr, maxLength), nil},
+		{"缺少 CRC", buildPNG(ihdr, pngChunkBytes("eXIf", exifData)[:8+len(exifData)]), nil},
+		{"只有签名", []byte(pngSignature), nil},
+		{"不是 PNG", append([]byte("GIF89a\x00\x00"), pngChunkBytes("eXIf", exifData)...), nil},
+		{"空文件", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pngChunk(tt.data, "eXIf")
+			if (got == nil) != (tt.want == nil) || !bytes.Equal(got, tt.want) {
+				t.Errorf("pngChunk = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 任意位置截断都不能越界访问
+func TestPNGChunkTruncated(t *testing.T) {
+	data := buildPNG(pngIHDR(1, 1), pngChunkBytes("eXIf", []byte("MM\x00\x2a")), pngChunkBytes("IEND", nil))
+	for i := range data {
+		pngChunk(data[:i], "eXIf")
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+	"image-hosting/internal/storage"
+)
+
+// newTestConfig 返回数据全部保存在临时目录中的默认配置
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Storage.BasePath = filepath.Join(dir, "images")
+	cfg.Image.Variants.CachePath = filepath.Join(dir, "cache")
+	cfg.Image.Private.SigningKey = "test-signing-key"
+	cfg.Tus.UploadDir = filepath.Join(dir, "tus")
+	cfg.Jobs.Dir = filepath.Join(dir, "jobs")
+	cfg.Quota.UsageFile = filepath.Join(dir, "usage.json")
+	cfg.Auth.KeysFile = filepath.Join(dir, "api_keys.json")
+	return cfg
+}
+
+// newTestImageService 使用本地存储与 JSON 元数据创建图片服务
+func newTestImageService(t *testing.T, cfg *config.Config) *ImageService {
+	t.Helper()
+	store, err := storage.NewLocalStorage(cfg.Storage.BasePath, cfg.Storage.BaseURL)
+	if err != nil {
+		t.Fatalf("NewLocalStorage error: %v", err)
+	}
+	accounts, err := NewAccountService(&cfg.Auth, &cfg.Quota.Default)
+	if err != nil {
+		t.Fatalf("NewAccountService error: %v", err)
+	}
+	s, err := NewImageService(cfg, store, accounts)
+	if err != nil {
+		t.Fatalf("NewImageService error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testPNG 生成指定尺寸与颜色的 PNG，不同颜色的图片不会被去重合并
+func testPNG(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// uploadTestImage 上传图片并返回保存的元数据
+func uploadTestImage(t *testing.T, s *ImageService, data []byte, opts UploadOptions) *model.Image {
+	t.Helper()
+	result, err := s.Upload(context.Background(), bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+	img, err := s.GetImage(context.Background(), nil, result.ID)
+	if err != nil {
+		t.Fatalf("GetImage error: %v", err)
+	}
+	return img
+}
@@ -6,72 +6,279 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
 
+	"image-hosting/internal/config"
+
 	"github.com/chai2010/webp"
 	"github.com/disintegration/imaging"
 	"github.com/rwcarlsen/goexif/exif"
 	xwebp "golang.org/x/image/webp"
 )
 
+// 输出格式
+const (
+	FormatWebP = "webp"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatAVIF = "avif"
+	FormatGIF  = "gif" // 仅用于保留原始动图
+)
+
+// 缩放模式
+const (
+	FitCover   = "cover"
+	FitContain = "contain"
+	FitFill    = "fill"
+)
+
 // ImageProcessor 图片处理器
 // 负责图片格式转换、压缩、EXIF 处理等
 type ImageProcessor struct {
-	quality int // WebP 压缩质量 (1-100)
+	quality   int                     // WebP 压缩质量 (1-100)
+	avif      *AVIFCodec              // AVIF 编解码器，为 nil 时不支持 AVIF
+	animation *config.AnimationConfig // 动图配置
 }
 
 // NewImageProcessor 创建图片处理器
-func NewImageProcessor(quality int) *ImageProcessor {
+// avif 为 nil 时不支持 AVIF 格式
+func NewImageProcessor(quality int, avif *AVIFCodec, animation *config.AnimationConfig) *ImageProcessor {
 	if quality < 1 || quality > 100 {
 		quality = 75 // 默认质量
 	}
-	return &ImageProcessor{quality: quality}
+	return &ImageProcessor{quality: quality, avif: avif, animation: animation}
+}
+
+// DefaultQuality 指定格式的默认压缩质量
+func (p *ImageProcessor) DefaultQuality(format string) int {
+	if format == FormatAVIF && p.avif != nil {
+		return p.avif.quality
+	}
+	return p.quality
+}
+
+// SupportsFormat 是否支持输出指定格式
+func (p *ImageProcessor) SupportsFormat(format string) bool {
+	switch format {
+	case FormatWebP, FormatJPEG, FormatPNG:
+		return true
+	case FormatAVIF:
+		return p.avif != nil
+	default:
+		return false
+	}
 }
 
 // ProcessResult 图片处理结果
 type ProcessResult struct {
-	Data   []byte // 处理后的图片数据
-	Width  int    // 图片宽度
-	Height int    // 图片高度
-	Format string // 输出格式 (webp)
+	Data   []byte      // 处理后的图片数据
+	Width  int         // 图片宽度
+	Height int         // 图片高度
+	Format string      // 输出格式 (webp/avif/gif)
+	Image  image.Image // 解码并修正方向后的图片，用于生成缩略图；动图为第一帧
+
+	Animated bool // 是否为动图
+	Frames   int  // 动图帧数
 }
 
 // Process 处理图片
 // 1. 解码图片
 // 2. 修正 EXIF 方向
-// 3. 转换为 WebP 格式
-// 4. 压缩
-func (p *ImageProcessor) Process(data []byte, mimeType string) (*ProcessResult, error) {
+// 3. 添加水印 (wm 为 nil 时跳过)
+// 4. 转换为输出格式 (WebP 或 AVIF)
+// 5. 压缩
+func (p *ImageProcessor) Process(data []byte, mimeType, format string, wm *Watermark) (*ProcessResult, error) {
+	// 动图保留全部帧，不受 format 影响
+	anim, err := p.DecodeAnimation(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode animation: %w", err)
+	}
+	if anim != nil {
+		return p.processAnimation(data, mimeType, anim, wm)
+	}
+
 	// 解码图片
-	img, format, err := p.decodeImage(data, mimeType)
+	img, srcFormat, err := p.decodeImage(data, mimeType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
 	// 修正 EXIF 方向 (仅 JPEG)
-	if format == "jpeg" {
+	if srcFormat == "jpeg" {
 		img = p.fixOrientation(data, img)
 	}
 
-	// 编码为 WebP
-	webpData, err := p.encodeWebP(img)
+	// 添加水印，小于最小尺寸的图片不处理
+	img = wm.Apply(img)
+
+	// 编码为输出格式
+	var encoded []byte
+	switch format {
+	case FormatWebP:
+		encoded, err = p.encodeWebP(img)
+	case FormatAVIF:
+		encoded, err = p.Encode(img, FormatAVIF, 0)
+	default:
+		err = fmt.Errorf("unsupported output format: %s", format)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode webp: %w", err)
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
 	}
 
 	bounds := img.Bounds()
 	return &ProcessResult{
-		Data:   webpData,
+		Data:   encoded,
 		Width:  bounds.Dx(),
 		Height: bounds.Dy(),
-		Format: "webp",
+		Format: format,
+		Image:  img,
 	}, nil
 }
 
+// DecodeAnimation 解码动图 (多帧 GIF 或动画 WebP)
+// 不是动图或未启用动图支持时返回 nil, nil
+func (p *ImageProcessor) DecodeAnimation(data []byte) (*Animation, error) {
+	if p.animation == nil || !p.animation.Enabled {
+		return nil, nil
+	}
+	return decodeAnimation(data, detectMimeFromHeader(data), p.animation.MaxFrames, p.animation.MaxTotalMegapixels)
+}
+
+// EncodeAnimation 将动图编码为动画 WebP 或 GIF
+// quality 为 0 时使用处理器默认质量，GIF 不支持质量参数
+func (p *ImageProcessor) EncodeAnimation(anim *Animation, format string, quality int) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		quality = p.quality
+	}
+
+	switch format {
+	case FormatWebP:
+		return encodeWebPAnimation(anim, quality)
+	case FormatGIF:
+		return encodeGIFAnimation(anim)
+	default:
+		return nil, fmt.Errorf("unsupported animation format: %s", format)
+	}
+}
+
+// processAnimation 处理动图，保留全部帧与时长
+// 动画 WebP 原样保存，避免重复有损压缩；GIF 按 gif_output 配置转换或保留
+// 添加水印时逐帧处理后重新编码
+func (p *ImageProcessor) processAnimation(data []byte, mimeType string, anim *Animation, wm *Watermark) (*ProcessResult, error) {
+	watermarked := wm.Applies(anim.Width, anim.Height)
+	if watermarked {
+		anim.Frames = wm.ApplyAll(anim.Frames)
+	}
+
+	result := &ProcessResult{
+		Data:     data,
+		Width:    anim.Width,
+		Height:   anim.Height,
+		Format:   FormatWebP,
+		Image:    anim.Frames[0],
+		Animated: true,
+		Frames:   len(anim.Frames),
+	}
+
+	output := p.animation.GIFOutput
+	if mimeType != "image/gif" {
+		if !watermarked {
+			return result, nil
+		}
+		output = FormatWebP
+	}
+
+	// 加水印后原 GIF 不再可用，需要重新编码
+	gifData := data
+	if watermarked && output != FormatWebP {
+		var err error
+		if gifData, err = encodeGIFAnimation(anim); err != nil {
+			return nil, fmt.Errorf("failed to encode gif: %w", err)
+		}
+	}
+
+	if output == FormatGIF {
+		result.Data = gifData
+		result.Format = FormatGIF
+		return result, nil
+	}
+
+	encoded, err := encodeWebPAnimation(anim, p.quality)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode animated webp: %w", err)
+	}
+
+	// smaller: 转换后反而更大时保留 GIF
+	if output == "smaller" && len(encoded) >= len(gifData) {
+		result.Data = gifData
+		result.Format = FormatGIF
+		return result, nil
+	}
+
+	result.Data = encoded
+	return result, nil
+}
+
+// Decode 解码图片并修正 EXIF 方向
+func (p *ImageProcessor) Decode(data []byte) (image.Image, error) {
+	img, format, err := p.decodeImage(data, detectMimeFromHeader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		img = p.fixOrientation(data, img)
+	}
+	return img, nil
+}
+
+// decodeDimensions 只读取文件头中声明的像素尺寸，不解码像素数据
+// 用于在完整解码前拒绝像素过多的图片 (解压炸弹)
+func decodeDimensions(data []byte, mimeType string) (int, int, error) {
+	var cfg image.Config
+	var err error
+
+	reader := bytes.NewReader(data)
+	switch mimeType {
+	case "image/jpeg":
+		cfg, err = jpeg.DecodeConfig(reader)
+	case "image/png":
+		cfg, err = png.DecodeConfig(reader)
+	case "image/gif":
+		// 各帧不能超出逻辑屏幕，解码时由 image/gif 检查
+		cfg, err = gif.DecodeConfig(reader)
+	case "image/webp":
+		return webpDimensions(data)
+	case "image/avif":
+		return avifDimensions(data)
+	default:
+		return 0, 0, fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+	return cfg.Width, cfg.Height, err
+}
+
+// decodeFrameCount 读取动图的帧数，不解码像素数据；静态图片返回 1
+func decodeFrameCount(data []byte, mimeType string) (int, error) {
+	switch {
+	case mimeType == "image/gif":
+		info, err := scanGIF(data)
+		if err != nil {
+			return 0, err
+		}
+		return info.frames, nil
+	case mimeType == "image/webp" && isAnimatedWebP(data):
+		return webpFrameCount(data)
+	default:
+		return 1, nil
+	}
+}
+
 // decodeImage 解码图片
-// 支持 JPEG、PNG、WebP 格式
+// 支持 JPEG、PNG、WebP、GIF 格式，配置了 avifdec 时支持 AVIF；动图只解码第一帧
 func (p *ImageProcessor) decodeImage(data []byte, mimeType string) (image.Image, string, error) {
 	reader := bytes.NewReader(data)
 
@@ -83,8 +290,22 @@ func (p *ImageProcessor) decodeImage(data []byte, mimeType string) (image.Image,
 		img, err := png.Decode(reader)
 		return img, "png", err
 	case "image/webp":
+		// 动画 WebP 取第一帧
+		if isAnimatedWebP(data) {
+			img, err := decodeWebPFirstFrame(data)
+			return img, "webp", err
+		}
 		img, err := xwebp.Decode(reader)
 		return img, "webp", err
+	case "image/gif":
+		img, err := gif.Decode(reader)
+		return img, "gif", err
+	case "image/avif":
+		if p.avif == nil {
+			return nil, "", ErrAVIFUnavailable
+		}
+		img, err := p.avif.Decode(data)
+		return img, "avif", err
 	default:
 		return nil, "", fmt.Errorf("unsupported image type: %s", mimeType)
 	}
@@ -148,6 +369,86 @@ func (p *ImageProcessor) encodeWebP(img image.Image) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Resize 按指定模式缩放图片
+// width / height 为 0 时按另一边等比缩放
+// fit 取值:
+//   - cover:   等比缩放并居中裁剪，填满目标尺寸
+//   - contain: 等比缩放，完整显示在目标尺寸内，不放大
+//   - fill:    拉伸到目标尺寸，不保持比例
+func (p *ImageProcessor) Resize(img image.Image, width, height int, fit string) image.Image {
+	if width <= 0 && height <= 0 {
+		return img
+	}
+
+	// 只指定一边时，三种模式都退化为等比缩放
+	if width <= 0 || height <= 0 {
+		bounds := img.Bounds()
+		if fit == FitContain && (width > bounds.Dx() || height > bounds.Dy()) {
+			return img
+		}
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+
+	switch fit {
+	case FitContain:
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	case FitFill:
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	default:
+		return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+	}
+}
+
+// Encode 将图片编码为指定格式
+// quality 为 0 时使用处理器默认质量，AVIF 使用 avif.quality
+func (p *ImageProcessor) Encode(img image.Image, format string, quality int) ([]byte, error) {
+	if format == FormatAVIF {
+		if p.avif == nil {
+			return nil, ErrAVIFUnavailable
+		}
+		return p.avif.Encode(img, quality)
+	}
+
+	if quality < 1 || quality > 100 {
+		quality = p.quality
+	}
+
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case FormatWebP:
+		err = webp.Encode(&buf, img, &webp.Options{
+			Lossless: false,
+			Quality:  float32(quality),
+		})
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, flattenAlpha(img), &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatGIF:
+		err = gif.Encode(&buf, img, &gif.Options{NumColors: 256, Drawer: draw.FloydSteinberg})
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// flattenAlpha 将透明图片合成到白色背景上
+// JPEG 不支持透明通道，直接编码时透明区域会变成黑色
+func flattenAlpha(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	bounds := img.Bounds()
+	bg := imaging.New(bounds.Dx(), bounds.Dy(), color.White)
+	return imaging.Overlay(bg, img, image.Pt(0, 0), 1.0)
+}
+
 // ValidateMimeType 验证 MIME 类型是否允许
 func ValidateMimeType(mimeType string, allowedTypes []string) bool {
 	for _, t := range allowedTypes {
@@ -159,12 +460,12 @@ func ValidateMimeType(mimeType string, allowedTypes []string) bool {
 }
 
 // DetectMimeType 检测文件的真实 MIME 类型
-// 通过读取文件头部字节来判断，而非依赖文件扩展名
+// 通过读取文件头部字节来判断，而非依赖文件扩展名；返回已读取的文件头，调用方需拼接回剩余内容
 func DetectMimeType(reader io.Reader) (string, []byte, error) {
-	// 读取文件头部用于检测
+	// 读取文件头部用于检测，文件不足 512 字节时读取全部
 	header := make([]byte, 512)
-	n, err := reader.Read(header)
-	if err != nil && err != io.EOF {
+	n, err := io.ReadFull(reader, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", nil, err
 	}
 	header = header[:n]
@@ -200,5 +501,18 @@ func detectMimeFromHeader(header []byte) string {
 		return "image/webp"
 	}
 
+	// GIF: GIF87a / GIF89a
+	if len(header) >= 6 && string(header[0:3]) == "GIF" &&
+		(string(header[3:6]) == "87a" || string(header[3:6]) == "89a") {
+		return "image/gif"
+	}
+
+	// AVIF: ....ftypavif / ....ftypavis (ISO BMFF)
+	if len(header) >= 12 &&
+		header[4] == 'f' && header[5] == 't' && header[6] == 'y' && header[7] == 'p' &&
+		header[8] == 'a' && header[9] == 'v' && header[10] == 'i' && (header[11] == 'f' || header[11] == 's') {
+		return "image/avif"
+	}
+
 	return "application/octet-stream"
 }
@@ -3,12 +3,11 @@ package service
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"log"
 	"path/filepath"
-	"sort"
 	"sync"
 	"time"
 
@@ -25,245 +24,429 @@ type ImageService struct {
 	storage   storage.Storage
 	processor *ImageProcessor
 	config    *config.Config
-	metadata  *MetadataStore
+	metadata  MetadataStore
+	variants  *VariantService
+	watermark *Watermark // 全局水印配置，上传时按参数覆盖
+	pool      *WorkerPool
+	remote    *RemoteFetcher // 为 nil 时不支持通过 URL 上传
+	quotas    *QuotaTracker
+	signer    *URLSigner // 私有图片签名地址
+
+	refMu sync.Mutex // 保护引用计数的读-改-写，去重查找与删除需串行
 }
 
-// MetadataStore 图片元数据存储
-// 使用 JSON 文件存储元数据，便于简单部署
-// 生产环境建议替换为数据库
-type MetadataStore struct {
-	mu       sync.Mutex  // 改用互斥锁，确保读写串行
-	images   map[string]*model.Image
-	filePath string
-}
+// NewImageService 创建图片服务
+// accounts 提供用户与 API Key 的配额，为 nil 时不限制
+func NewImageService(cfg *config.Config, store storage.Storage, accounts *AccountService) (*ImageService, error) {
+	// 获取存储基础路径用于元数据存储
+	basePath := cfg.Storage.BasePath
+	if ls, ok := store.(*storage.LocalStorage); ok {
+		basePath = ls.GetBasePath()
+	}
 
-// NewMetadataStore 创建元数据存储
-func NewMetadataStore(basePath string) (*MetadataStore, error) {
-	filePath := filepath.Join(basePath, "metadata.json")
-	store := &MetadataStore{
-		images:   make(map[string]*model.Image),
-		filePath: filePath,
+	metadata, err := OpenMetadataStore(context.Background(), &cfg.Metadata, basePath, cfg.Storage.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata store: %w", err)
 	}
 
-	// 尝试加载已有数据
-	if err := store.load(); err != nil && !os.IsNotExist(err) {
+	if err := validateThumbnailConfigs(cfg.Image.Thumbnails); err != nil {
+		metadata.Close()
+		return nil, err
+	}
+	if err := validateExifPolicy(cfg.Image.Exif.Policy); err != nil {
+		metadata.Close()
+		return nil, err
+	}
+	if err := validateKeepOriginal(cfg); err != nil {
+		metadata.Close()
 		return nil, err
 	}
 
-	return store, nil
-}
-
-// load 从文件加载元数据（内部方法，调用前需持有锁）
-func (s *MetadataStore) loadLocked() error {
-	data, err := os.ReadFile(s.filePath)
+	// AVIF 依赖外部程序，未安装时仅在需要默认输出 AVIF 时报错
+	avif, err := NewAVIFCodec(&cfg.Image.AVIF)
 	if err != nil {
-		return err
+		if imageFormat(cfg.Image.Format) == FormatAVIF {
+			metadata.Close()
+			return nil, err
+		}
+		log.Printf("AVIF output disabled: %v", err)
+		avif = nil
 	}
 
-	return json.Unmarshal(data, &s.images)
-}
+	watermark, err := NewWatermark(&cfg.Image.Watermark)
+	if err != nil {
+		metadata.Close()
+		return nil, err
+	}
 
-// load 从文件加载元数据
-func (s *MetadataStore) load() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.loadLocked()
-}
+	var remote *RemoteFetcher
+	if cfg.Image.Remote.Enabled {
+		if remote, err = NewRemoteFetcher(&cfg.Image.Remote, cfg.Image.MaxSize); err != nil {
+			metadata.Close()
+			return nil, err
+		}
+	}
 
-// saveLocked 保存元数据到文件（内部方法，调用前需持有锁）
-func (s *MetadataStore) saveLocked() error {
-	data, err := json.MarshalIndent(s.images, "", "  ")
+	signer, err := NewURLSigner(&cfg.Image.Private)
 	if err != nil {
-		return err
+		metadata.Close()
+		return nil, err
 	}
 
-	// 先写入临时文件，再原子替换，防止写入中断导致数据损坏
-	tmpFile := s.filePath + ".tmp"
-	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
-		return err
+	quotas, err := NewQuotaTracker(context.Background(), &cfg.Quota, accounts, metadata)
+	if err != nil {
+		metadata.Close()
+		return nil, err
 	}
 
-	// 原子替换
-	if err := os.Rename(tmpFile, s.filePath); err != nil {
-		os.Remove(tmpFile) // 清理临时文件
-		return err
+	processor := NewImageProcessor(cfg.Image.Quality, avif, &cfg.Image.Animation)
+	pool := NewWorkerPool(&cfg.Image.Processing)
+	variants, err := NewVariantService(&cfg.Image.Variants, store, processor, pool)
+	if err != nil {
+		metadata.Close()
+		return nil, err
 	}
 
-	return nil
+	return &ImageService{
+		storage:   store,
+		processor: processor,
+		config:    cfg,
+		metadata:  metadata,
+		variants:  variants,
+		watermark: watermark,
+		pool:      pool,
+		remote:    remote,
+		quotas:    quotas,
+		signer:    signer,
+	}, nil
 }
 
-// Add 添加图片元数据
-func (s *MetadataStore) Add(img *model.Image) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	s.images[img.ID] = img
-	return s.saveLocked()
+// Variants 获取图片变体服务
+func (s *ImageService) Variants() *VariantService {
+	return s.variants
 }
 
-// Delete 删除图片元数据
-func (s *MetadataStore) Delete(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	delete(s.images, id)
-	return s.saveLocked()
+// MaxSize 单个文件的最大大小 (bytes)
+func (s *ImageService) MaxSize() int64 {
+	return s.config.Image.MaxSize
 }
 
-// List 列出所有图片
-func (s *MetadataStore) List() []*model.Image {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	images := make([]*model.Image, 0, len(s.images))
-	for _, img := range s.images {
-		// 复制一份，避免外部修改
-		imgCopy := *img
-		images = append(images, &imgCopy)
+// MaxBatchFiles 批量上传单次请求的最多文件数
+// 请求体大小按该值限制，因此未配置时使用 defaultMaxBatchFiles，不允许不限制
+func (s *ImageService) MaxBatchFiles() int {
+	if n := s.config.Image.Batch.MaxFiles; n > 0 {
+		return n
 	}
-
-	// 按创建时间倒序排列
-	sort.Slice(images, func(i, j int) bool {
-		return images[i].CreatedAt.After(images[j].CreatedAt)
-	})
-
-	return images
+	return defaultMaxBatchFiles
 }
 
-// Get 获取图片元数据
-func (s *MetadataStore) Get(id string) (*model.Image, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Close 释放服务持有的资源
+func (s *ImageService) Close() error {
+	return s.metadata.Close()
+}
 
-	img, ok := s.images[id]
-	if !ok {
-		return nil, false
-	}
-	// 返回副本
-	imgCopy := *img
-	return &imgCopy, true
+// UploadOptions 单次上传的可选参数
+type UploadOptions struct {
+	Format     string           `json:"format,omitempty"`     // 输出格式: webp / avif，为空时使用 image.format
+	Watermark  WatermarkOptions `json:"watermark"`            // 水印参数，零值使用 image.watermark
+	SourceURL  string           `json:"source_url,omitempty"` // 通过 URL 上传时的来源地址，由服务设置
+	OwnerID    string           `json:"owner_id,omitempty"`   // 上传者用户名，由 handler 根据鉴权结果设置
+	KeyID      string           `json:"key_id,omitempty"`     // 上传时使用的 API Key，由 handler 根据鉴权结果设置
+	Visibility string           `json:"visibility,omitempty"` // 可见性: public / private，为空时为 public
 }
 
-// Count 获取图片总数
-func (s *MetadataStore) Count() int64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return int64(len(s.images))
+// ValidateOptions 提前校验上传参数与配额
+// 断点续传、异步上传与 URL 上传在接收文件前调用，避免文件接收完成后才失败
+func (s *ImageService) ValidateOptions(opts UploadOptions) error {
+	if _, err := s.resolveFormat(opts.Format); err != nil {
+		return err
+	}
+	if _, err := s.resolveWatermark(opts.Watermark); err != nil {
+		return err
+	}
+	if _, err := s.resolveVisibility(opts.Visibility); err != nil {
+		return err
+	}
+	return s.quotas.Check(opts.OwnerID, opts.KeyID)
 }
 
-// Reload 重新从文件加载数据
-func (s *MetadataStore) Reload() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.loadLocked()
+// checkFileType 检查根据文件头检测出的 MIME 类型是否允许
+func (s *ImageService) checkFileType(mimeType string) error {
+	if !ValidateMimeType(mimeType, s.config.Image.AllowedTypes) {
+		return &InvalidFileTypeError{MimeType: mimeType, AllowedTypes: s.config.Image.AllowedTypes}
+	}
+	return nil
 }
 
-// NewImageService 创建图片服务
-func NewImageService(cfg *config.Config, store storage.Storage) (*ImageService, error) {
-	// 获取存储基础路径用于元数据存储
-	basePath := cfg.Storage.BasePath
-	if ls, ok := store.(*storage.LocalStorage); ok {
-		basePath = ls.GetBasePath()
+// resolveFormat 确定输出格式并检查是否可用
+func (s *ImageService) resolveFormat(format string) (string, error) {
+	if format == "" {
+		format = s.config.Image.Format
 	}
+	format = imageFormat(format)
 
-	metadata, err := NewMetadataStore(basePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create metadata store: %w", err)
+	if format != FormatWebP && format != FormatAVIF {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
 	}
+	if !s.processor.SupportsFormat(format) {
+		return "", fmt.Errorf("%w: %s (%v)", ErrUnsupportedFormat, format, ErrAVIFUnavailable)
+	}
+	return format, nil
+}
 
-	return &ImageService{
-		storage:   store,
-		processor: NewImageProcessor(cfg.Image.Quality),
-		config:    cfg,
-		metadata:  metadata,
-	}, nil
+// resolveWatermark 合并全局水印配置与单次上传参数
+// 不添加水印时返回 nil
+func (s *ImageService) resolveWatermark(opts WatermarkOptions) (*Watermark, error) {
+	return s.watermark.With(s.config.Image.Watermark.Enabled, opts)
 }
 
 // Upload 上传并处理图片
 // 完整流程: 验证 -> 处理 -> 存储 -> 记录元数据
-func (s *ImageService) Upload(ctx context.Context, file io.Reader, originalSize int64) (*model.UploadResult, error) {
-	// 1. 读取文件内容
-	data, err := io.ReadAll(file)
+// size 为客户端声明的文件大小，超过限制时不读取内容直接拒绝；未知时传 -1
+func (s *ImageService) Upload(ctx context.Context, file io.Reader, size int64, opts UploadOptions) (*model.UploadResult, error) {
+	format, err := s.resolveFormat(opts.Format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, err
+	}
+	watermark, err := s.resolveWatermark(opts.Watermark)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err := s.resolveVisibility(opts.Visibility)
+	if err != nil {
+		return nil, err
 	}
 
-	// 2. 检测并验证 MIME 类型
-	mimeType := detectMimeFromHeader(data)
-	if !ValidateMimeType(mimeType, s.config.Image.AllowedTypes) {
-		return nil, fmt.Errorf("invalid file type: %s", mimeType)
+	if size > s.config.Image.MaxSize {
+		return nil, &FileTooLargeError{Size: size, MaxSize: s.config.Image.MaxSize}
 	}
 
-	// 3. 检查文件大小
-	if int64(len(data)) > s.config.Image.MaxSize {
-		return nil, fmt.Errorf("file too large: %d bytes (max: %d)", len(data), s.config.Image.MaxSize)
+	// 预占配额，上传失败时释放
+	quota, err := s.quotas.reserve(opts.OwnerID, opts.KeyID)
+	if err != nil {
+		return nil, err
 	}
+	defer quota.release()
 
-	// 4. 处理图片 (EXIF 修正 + WebP 转换 + 压缩)
-	result, err := s.processor.Process(data, mimeType)
+	// 1. 暂存文件: 检测并验证 MIME 类型，检查文件大小，计算内容哈希
+	spool, err := s.spoolUpload(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process image: %w", err)
+		return nil, err
+	}
+	defer spool.Close()
+	mimeType := spool.mimeType
+
+	// 2. 启用去重时相同内容直接返回已有图片
+	// 添加水印时处理结果还取决于水印参数，不记录内容哈希，只按处理结果去重
+	contentHash := spool.hash
+	if watermark != nil {
+		contentHash = ""
+	}
+	if s.config.Image.Dedupe {
+		existing, err := s.acquireDuplicate(ctx, opts.OwnerID, format, visibility, contentHash)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			quota.commitDuplicate()
+			return newUploadResult(existing, true), nil
+		}
+	}
+
+	// 3. 处理图片 (EXIF 修正 + 水印 + 格式转换 + 压缩)，受处理池并发限制
+	// 占用槽位后才读入原图，先检查像素尺寸再解码
+	var result *ProcessResult
+	var exifInfo *model.Exif
+	err = s.pool.Do(ctx, func() error {
+		data, err := spool.ReadAll()
+		if err != nil {
+			return err
+		}
+		if err := s.checkDimensions(data, mimeType); err != nil {
+			return err
+		}
+		if result, err = s.processor.Process(data, mimeType, format, watermark); err != nil {
+			return processingError(err)
+		}
+		exifInfo = extractExif(data, mimeType)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 动图的输出格式由处理结果决定 (动画 WebP 或原 GIF)
+	format = result.Format
+
+	// 原样保存的动画 WebP 可能带有 EXIF / XMP，按策略删除
+	exifPolicy := s.config.Image.Exif.Policy
+	if result.Animated && format == FormatWebP && exifPolicy != ExifKeep {
+		result.Data = stripWebPMetadata(result.Data)
 	}
+	processedHash := sha256Hex(result.Data)
 
-	// 5. 生成存储路径 (年/月/uuid.webp)
+	// 原始文件不同但处理结果相同 (如仅 EXIF 不同)，同样视为重复
+	if s.config.Image.Dedupe {
+		existing, err := s.acquireDuplicate(ctx, opts.OwnerID, format, visibility, processedHash)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			quota.commitDuplicate()
+			return newUploadResult(existing, true), nil
+		}
+	}
+
+	// 4. 生成存储路径 (年/月/uuid.webp，或 .avif / .gif)
 	now := time.Now()
 	id := uuid.New().String()
-	filename := fmt.Sprintf("%s.webp", id) // WebP 格式输出
+	filename := fmt.Sprintf("%s.%s", id, format)
 	storagePath := fmt.Sprintf("%d/%02d/%s", now.Year(), now.Month(), filename)
 
-	// 6. 保存文件
+	// 5. 保存文件
 	url, err := s.storage.Save(ctx, storagePath, bytes.NewReader(result.Data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to save file: %w", err)
+		return nil, &StorageError{Op: "save", Err: err}
 	}
 
-	// 7. 提取原始格式
+	// 6. 提取原始格式，启用 image.keep_original 时保存原图
+	// uploaded 为已保存的文件，后续步骤失败时删除
 	originalFormat := mimeTypeToFormat(mimeType)
+	uploaded := []string{storagePath}
+	if s.config.Image.KeepOriginal {
+		p, err := s.saveOriginal(ctx, storagePath, originalFormat, spool)
+		if err != nil {
+			s.deleteFiles(ctx, uploaded)
+			return nil, err
+		}
+		uploaded = append(uploaded, p)
+	}
+
+	// 7. 生成缩略图
+	thumbnails, thumbnailPaths, err := s.generateThumbnails(ctx, result.Image, storagePath)
+	if err != nil {
+		s.deleteFiles(ctx, uploaded)
+		return nil, err
+	}
 
 	// 8. 创建图片记录
 	img := &model.Image{
 		ID:             id,
 		URL:            url,
 		OriginalFormat: originalFormat,
-		OriginalSize:   originalSize,
+		Format:         format,
+		OriginalSize:   spool.size,
 		ProcessedSize:  int64(len(result.Data)),
 		Width:          result.Width,
 		Height:         result.Height,
+		Animated:       result.Animated,
+		FrameCount:     result.Frames,
 		CreatedAt:      now,
 		Filename:       filename,
 		StoragePath:    storagePath,
+		Thumbnails:     thumbnails,
+		ContentHash:    contentHash,
+		ProcessedHash:  processedHash,
+		Exif:           applyExifPolicy(exifInfo, exifPolicy),
+		SourceURL:      opts.SourceURL,
+		HasOriginal:    len(uploaded) > 1,
+		OwnerID:        opts.OwnerID,
+		KeyID:          opts.KeyID,
+		Visibility:     visibility,
 	}
 
 	// 9. 保存元数据
-	if err := s.metadata.Add(img); err != nil {
-		// 元数据保存失败，删除已上传的文件
-		s.storage.Delete(ctx, storagePath)
-		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	existing, err := s.addImage(ctx, img, quota)
+	if err != nil || existing != nil {
+		// 元数据保存失败或并发上传了相同内容，删除已上传的文件
+		s.deleteFiles(ctx, uploaded)
+		s.deleteFiles(ctx, thumbnailPaths)
+		if err != nil {
+			return nil, err
+		}
+		return newUploadResult(existing, true), nil
 	}
 
+	return newUploadResult(img, false), nil
+}
+
+// checkDimensions 根据文件头中声明的尺寸检查像素限制
+// 体积很小的图片也可能声明极大的尺寸 (解压炸弹)，必须在完整解码前拒绝；
+// 保留动画时还按帧数检查全部帧的总像素数
+func (s *ImageService) checkDimensions(data []byte, mimeType string) error {
+	width, height, err := decodeDimensions(data, mimeType)
+	if err != nil {
+		return processingError(fmt.Errorf("failed to read image size: %w", err))
+	}
+
+	cfg := &s.config.Image
+	pixels := float64(width) * float64(height)
+	if (cfg.MaxWidth > 0 && width > cfg.MaxWidth) ||
+		(cfg.MaxHeight > 0 && height > cfg.MaxHeight) ||
+		(cfg.MaxMegapixels > 0 && pixels > cfg.MaxMegapixels*1e6) {
+		return &ImageTooLargeError{
+			Width:         width,
+			Height:        height,
+			MaxWidth:      cfg.MaxWidth,
+			MaxHeight:     cfg.MaxHeight,
+			MaxMegapixels: cfg.MaxMegapixels,
+		}
+	}
+
+	if anim := &cfg.Animation; anim.Enabled && (anim.MaxFrames > 0 || anim.MaxTotalMegapixels > 0) {
+		frames, err := decodeFrameCount(data, mimeType)
+		if err != nil {
+			return processingError(fmt.Errorf("failed to read frame count: %w", err))
+		}
+		if err := checkAnimationSize(width, height, frames, anim.MaxFrames, anim.MaxTotalMegapixels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newUploadResult 由图片记录生成上传结果，私有图片不包含访问地址
+func newUploadResult(img *model.Image, deduplicated bool) *model.UploadResult {
+	url, thumbnails := hidePrivateURLs(img)
 	return &model.UploadResult{
 		ID:             img.ID,
-		URL:            img.URL,
+		URL:            url,
 		OriginalFormat: img.OriginalFormat,
+		Format:         imageFormat(img.Format),
 		OriginalSize:   img.OriginalSize,
 		ProcessedSize:  img.ProcessedSize,
 		Width:          img.Width,
 		Height:         img.Height,
+		Animated:       img.Animated,
+		FrameCount:     img.FrameCount,
 		CreatedAt:      img.CreatedAt,
-	}, nil
+		Thumbnails:     thumbnails,
+		ContentHash:    img.ContentHash,
+		SourceURL:      img.SourceURL,
+		Visibility:     img.Visibility,
+		Deduplicated:   deduplicated,
+	}
 }
 
 // GetImage 获取单张图片信息
-func (s *ImageService) GetImage(ctx context.Context, id string) (*model.Image, error) {
-	img, ok := s.metadata.Get(id)
-	if !ok {
-		return nil, fmt.Errorf("image not found: %s", id)
+// user 不为 nil 时只能获取自己上传的图片 (管理员除外)，其他用户的图片视为不存在
+func (s *ImageService) GetImage(ctx context.Context, user *model.User, id string) (*model.Image, error) {
+	img, err := s.metadata.Get(ctx, id)
+	if errors.Is(err, ErrMetadataNotFound) || (err == nil && !canAccess(user, img.OwnerID)) {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, id)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	// 按当前策略过滤，修改配置后已保存的信息同样不再返回
+	img.Exif = applyExifPolicy(img.Exif, s.config.Image.Exif.Policy)
 	return img, nil
 }
 
 // ListImages 获取图片列表
-func (s *ImageService) ListImages(ctx context.Context, page, pageSize int) (*model.PaginatedList, error) {
+// format 不为空时只返回该原始格式的图片；user 不为 nil 且不是管理员时只返回自己上传的图片
+func (s *ImageService) ListImages(ctx context.Context, user *model.User, page, pageSize int, format string) (*model.PaginatedList, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -271,31 +454,43 @@ func (s *ImageService) ListImages(ctx context.Context, page, pageSize int) (*mod
 		pageSize = 20
 	}
 
-	allImages := s.metadata.List()
-	total := int64(len(allImages))
-
-	// 计算分页
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(allImages) {
-		start = len(allImages)
+	opts := ListOptions{
+		Offset: (page - 1) * pageSize,
+		Limit:  pageSize,
+		Format: format,
 	}
-	if end > len(allImages) {
-		end = len(allImages)
+	if user != nil && !user.IsAdmin() {
+		opts.OwnerID = user.Username
 	}
 
-	// 转换为列表项
-	items := make([]model.ImageListItem, 0, end-start)
-	for _, img := range allImages[start:end] {
-		items = append(items, model.ImageListItem{
+	// 分页查询
+	images, total, err := s.metadata.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata: %w", err)
+	}
+
+	// 转换为列表项，私有图片不包含访问地址
+	items := make([]model.ImageListItem, 0, len(images))
+	for _, img := range images {
+		url, thumbnails := hidePrivateURLs(img)
+		item := model.ImageListItem{
 			ID:             img.ID,
-			URL:            img.URL,
+			URL:            url,
 			OriginalFormat: img.OriginalFormat,
+			Format:         imageFormat(img.Format),
 			ProcessedSize:  img.ProcessedSize,
 			Width:          img.Width,
 			Height:         img.Height,
+			Animated:       img.Animated,
 			CreatedAt:      img.CreatedAt,
-		})
+			Thumbnails:     thumbnails,
+			OwnerID:        img.OwnerID,
+			Visibility:     img.Visibility,
+		}
+		if len(thumbnails) > 0 {
+			item.ThumbnailURL = thumbnails[0].URL
+		}
+		items = append(items, item)
 	}
 
 	totalPages := int(total) / pageSize
@@ -313,10 +508,25 @@ func (s *ImageService) ListImages(ctx context.Context, page, pageSize int) (*mod
 }
 
 // DeleteImage 删除图片
-func (s *ImageService) DeleteImage(ctx context.Context, id string) error {
-	img, ok := s.metadata.Get(id)
-	if !ok {
-		return fmt.Errorf("image not found: %s", id)
+// 图片被多次上传引用时只减少引用计数，最后一个引用删除时才删除文件
+// user 不为 nil 时只能删除自己上传的图片 (管理员除外)
+func (s *ImageService) DeleteImage(ctx context.Context, user *model.User, id string) error {
+	// 检查与删除在同一把锁内完成，防止删除刚被重复上传引用的图片
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+
+	img, err := s.GetImage(ctx, user, id)
+	if err != nil {
+		return err
+	}
+
+	// 仍有其他引用，只减少引用计数
+	if refCount(img) > 1 {
+		img.RefCount--
+		if err := s.metadata.Add(ctx, img); err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+		return nil
 	}
 
 	// 验证存储路径是否有效
@@ -325,35 +535,51 @@ func (s *ImageService) DeleteImage(ctx context.Context, id string) error {
 	if storagePath == "" {
 		// 如果 StoragePath 为空，尝试从 URL 推断
 		// URL 格式: /images/年/月/文件名.webp
-		if img.URL != "" {
-			// 移除 /images/ 前缀
-			const prefix = "/images/"
-			if len(img.URL) > len(prefix) && img.URL[:len(prefix)] == prefix {
-				storagePath = img.URL[len(prefix):]
-			}
-		}
+		storagePath = storagePathFromURL(img.URL, s.config.Storage.BaseURL)
 	}
 
 	// 再次验证路径
 	if storagePath == "" || storagePath == "/" || !isValidStoragePath(storagePath) {
 		// 路径无效，只删除元数据，跳过文件删除
-		if err := s.metadata.Delete(id); err != nil {
+		if err := s.metadata.Delete(ctx, id); err != nil {
 			return fmt.Errorf("failed to delete metadata: %w", err)
 		}
+		s.quotas.removeImage(img)
 		return nil
 	}
 
-	// 删除文件
-	if err := s.storage.Delete(ctx, storagePath); err != nil {
-		// 如果文件不存在，继续删除元数据
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("failed to delete file: %w", err)
-		}
+	// 先删除元数据并释放配额，之后文件删除失败只会留下孤立文件，
+	// 不会留下仍可被去重命中、却缺少缩略图或原图的记录
+	if err := s.metadata.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
+	s.quotas.removeImage(img)
 
-	// 删除元数据
-	if err := s.metadata.Delete(id); err != nil {
-		return fmt.Errorf("failed to delete metadata: %w", err)
+	// 删除文件，失败不影响删除结果
+	if err := s.storage.Delete(ctx, storagePath); err != nil && !errors.Is(err, storage.ErrNotExist) {
+		log.Printf("[WARN] failed to delete %s: %v", storagePath, err)
+	}
+
+	// 清理变体缓存，失败不影响删除结果
+	if err := s.variants.Purge(ctx, storagePath); err != nil {
+		log.Printf("[WARN] failed to purge variants of %s: %v", storagePath, err)
+	}
+
+	// 删除缩略图
+	thumbnailPaths := make([]string, 0, len(img.Thumbnails))
+	for _, t := range img.Thumbnails {
+		thumbnailPaths = append(thumbnailPaths, thumbnailPath(storagePath, t.Name))
+	}
+	if err := s.deleteFiles(ctx, thumbnailPaths); err != nil {
+		log.Printf("[WARN] failed to delete thumbnails of %s: %v", storagePath, err)
+	}
+
+	// 删除保存的原图
+	if img.HasOriginal {
+		path := originalPath(storagePath, img.OriginalFormat)
+		if err := s.storage.Delete(ctx, path); err != nil && !errors.Is(err, storage.ErrNotExist) {
+			log.Printf("[WARN] failed to delete original %s: %v", path, err)
+		}
 	}
 
 	return nil
@@ -372,7 +598,16 @@ func isValidStoragePath(path string) bool {
 	}
 	// 检查是否有文件扩展名
 	ext := filepath.Ext(path)
-	return ext == ".webp" || ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+	return ext == ".webp" || ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".avif" || ext == ".gif"
+}
+
+// imageFormat 返回图片的输出格式
+// 支持 AVIF 之前的记录没有保存输出格式，均为 WebP
+func imageFormat(format string) string {
+	if format == "" {
+		return FormatWebP
+	}
+	return format
 }
 
 // mimeTypeToFormat 将 MIME 类型转换为格式名称
@@ -384,6 +619,10 @@ func mimeTypeToFormat(mimeType string) string {
 		return "png"
 	case "image/webp":
 		return "webp"
+	case "image/avif":
+		return "avif"
+	case "image/gif":
+		return "gif"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// 文件头声明的尺寸或帧数超过限制时，在解码像素之前拒绝
+// 测试数据只有文件头，不含可解码的图像数据，完整解码会返回其他错误
+func TestCheckDimensions(t *testing.T) {
+	s := newTestImageService(t, newTestConfig(t))
+
+	tests := []struct {
+		name       string
+		mime       string
+		data       []byte
+		wantErr    error
+		wantFrames int // ImageTooLargeError 中的帧数
+	}{
+		{"PNG 未超过限制", "image/png", buildPNG(pngIHDR(4000, 3000), pngChunkBytes("IEND", nil)), nil, 0},
+		{"PNG 声明 50000x50000", "image/png", buildPNG(pngIHDR(50000, 50000), pngChunkBytes("IEND", nil)), ErrImageTooLarge, 0},
+		{"PNG 宽度超过上限", "image/png", buildPNG(pngIHDR(16384, 1), pngChunkBytes("IEND", nil)), ErrImageTooLarge, 0},
+		{"WebP 声明 50000x50000", "image/webp", buildAnimatedWebP(50000, 50000, 1), ErrImageTooLarge, 0},
+		{"AVIF 声明 50000x50000", "image/avif", avifWithBoxes(ispeBox(50000, 50000)), ErrImageTooLarge, 0},
+		{"GIF 画布 65535x65535", "image/gif", buildGIF(65535, 65535, 1), ErrImageTooLarge, 0},
+		{"GIF 帧数超过 max_frames", "image/gif", buildGIF(10, 10, 301), ErrTooManyFrames, 0},
+		{"WebP 帧数超过 max_frames", "image/webp", buildAnimatedWebP(10, 10, 301), ErrTooManyFrames, 0},
+		{"GIF 总像素超过上限", "image/gif", buildGIF(5000, 5000, 5), ErrImageTooLarge, 5},
+		{"WebP 总像素超过上限", "image/webp", buildAnimatedWebP(4000, 4000, 10), ErrImageTooLarge, 10},
+		{"GIF 未超过限制", "image/gif", buildGIF(100, 100, 300), nil, 0},
+		{"缺少尺寸", "image/avif", avifWithBoxes(), ErrProcessingFailed, 0},
+		{"GIF 帧超出画布", "image/gif", buildGIF(0, 0, 1), ErrProcessingFailed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkDimensions(tt.data, tt.mime)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("checkDimensions error = %v, want %v", err, tt.wantErr)
+			}
+			var tooLarge *ImageTooLargeError
+			if errors.As(err, &tooLarge) && tooLarge.Frames != tt.wantFrames {
+				t.Errorf("ImageTooLargeError.Frames = %d, want %d", tooLarge.Frames, tt.wantFrames)
+			}
+		})
+	}
+}
+
+// 关闭动图支持时不检查帧数
+func TestCheckDimensionsAnimationDisabled(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Image.Animation.Enabled = false
+	s := newTestImageService(t, cfg)
+
+	if err := s.checkDimensions(buildGIF(10, 10, 301), "image/gif"); err != nil {
+		t.Errorf("checkDimensions error = %v, want nil", err)
+	}
+}
+
+// 上传流程在解码前拒绝声明尺寸过大的图片
+func TestUploadRejectsOversizedBeforeDecode(t *testing.T) {
+	s := newTestImageService(t, newTestConfig(t))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"PNG 声明 50000x50000", buildPNG(pngIHDR(50000, 50000), pngChunkBytes("IEND", nil)), ErrImageTooLarge},
+		{"WebP 声明 50000x50000", buildAnimatedWebP(50000, 50000, 1), ErrImageTooLarge},
+		{"GIF 帧数超过 max_frames", buildGIF(10, 10, 301), ErrTooManyFrames},
+		{"GIF 总像素超过上限", buildGIF(5000, 5000, 5), ErrImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Upload(context.Background(), bytes.NewReader(tt.data), int64(len(tt.data)), UploadOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Upload error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// max_files 未配置时使用默认值，批量上传的请求体始终有上限
+func TestCheckBatchMaxFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFiles int
+		count    int
+		want     int // MaxBatchFiles 的返回值
+		wantErr  bool
+	}{
+		{"未超过限制", 5, 5, 5, false},
+		{"超过限制", 5, 6, 5, true},
+		{"未配置时使用默认值", 0, defaultMaxBatchFiles, defaultMaxBatchFiles, false},
+		{"未配置时超过默认值", 0, defaultMaxBatchFiles + 1, defaultMaxBatchFiles, true},
+		{"负数时使用默认值", -1, defaultMaxBatchFiles + 1, defaultMaxBatchFiles, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.Image.Batch.MaxFiles = tt.maxFiles
+			s := newTestImageService(t, cfg)
+
+			if got := s.MaxBatchFiles(); got != tt.want {
+				t.Errorf("MaxBatchFiles = %d, want %d", got, tt.want)
+			}
+			err := s.CheckBatch(tt.count, UploadOptions{})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("CheckBatch error: %v", err)
+				}
+				return
+			}
+			var filesErr *TooManyFilesError
+			if !errors.As(err, &filesErr) || filesErr.MaxFiles != tt.want {
+				t.Errorf("CheckBatch error = %v, want *TooManyFilesError with max %d", err, tt.want)
+			}
+		})
+	}
+}
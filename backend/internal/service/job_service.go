@@ -0,0 +1,439 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobNotFound 任务不存在或已过期清理
+var ErrJobNotFound = errors.New("job not found")
+
+// jobRecord 任务文件内容
+// 以 JSON 形式保存在 {id}.json，待处理的原图保存在 {id}.bin
+type jobRecord struct {
+	model.Job
+	Size    int64         `json:"size"`    // 原图大小
+	Options UploadOptions `json:"options"` // 上传参数
+}
+
+// JobService 异步处理服务
+// 原图先写入任务目录并立即返回任务，由后台协程调用 ImageService.Upload 处理；
+// 任务状态保存在磁盘上，服务重启后继续处理未完成的任务
+type JobService struct {
+	imageService *ImageService
+	config       *config.JobsConfig
+	dir          string
+	errorCode    func(error) int // 将处理错误转换为业务错误码
+
+	queue chan string
+
+	mu      sync.Mutex // 保护任务文件的读-改-写
+	stop    chan struct{}
+	stopCtx context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewJobService 创建异步处理服务，恢复未完成的任务并启动后台处理与清理
+// errorCode 用于记录失败原因对应的错误码，与同步上传的错误响应保持一致
+func NewJobService(cfg *config.JobsConfig, imageService *ImageService, errorCode func(error) int) (*JobService, error) {
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+
+	pending, err := loadPendingJobs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	// 重启时未完成的任务可能多于队列长度，全部放入队列
+	queueSize = max(queueSize, len(pending))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &JobService{
+		imageService: imageService,
+		config:       cfg,
+		dir:          dir,
+		errorCode:    errorCode,
+		queue:        make(chan string, queueSize),
+		stop:         make(chan struct{}),
+		stopCtx:      ctx,
+		cancel:       cancel,
+	}
+
+	for _, id := range pending {
+		s.queue <- id
+	}
+	if len(pending) > 0 {
+		log.Printf("Resuming %d pending jobs", len(pending))
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	s.wg.Add(1)
+	go s.cleanupLoop()
+
+	return s, nil
+}
+
+// Close 停止后台处理
+// 正在等待处理池的任务放弃处理，保持 pending 状态，下次启动时继续
+func (s *JobService) Close() error {
+	close(s.stop)
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// jobPath / dataPath 任务文件路径
+func (s *JobService) jobPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *JobService) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+// Submit 保存原图并创建异步任务
+// 参数、文件类型与大小在此校验，校验失败直接返回错误，不创建任务
+func (s *JobService) Submit(ctx context.Context, file io.Reader, opts UploadOptions) (*model.Job, error) {
+	if err := s.imageService.ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	record := &jobRecord{
+		Job: model.Job{
+			ID:        uuid.New().String(),
+			Status:    model.JobPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Options: opts,
+	}
+
+	size, err := s.saveData(record.ID, file)
+	if err != nil {
+		os.Remove(s.dataPath(record.ID))
+		return nil, err
+	}
+	record.Size = size
+
+	if err := s.saveJob(record); err != nil {
+		os.Remove(s.dataPath(record.ID))
+		return nil, err
+	}
+
+	select {
+	case s.queue <- record.ID:
+	default:
+		s.remove(record.ID)
+		return nil, &ServerBusyError{RetryAfter: s.imageService.pool.retryAfter}
+	}
+
+	return &record.Job, nil
+}
+
+// saveData 写入原图并检查类型与大小
+func (s *JobService) saveData(id string, file io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// 先读取文件头检查类型，不允许的文件不必写入
+	mimeType, header, err := DetectMimeType(file)
+	if err != nil {
+		return 0, readError(err)
+	}
+	if err := s.imageService.checkFileType(mimeType); err != nil {
+		return 0, err
+	}
+
+	maxSize := s.imageService.config.Image.MaxSize
+	if _, err := f.Write(header); err != nil {
+		return 0, &StorageError{Op: "save", Err: err}
+	}
+	written, err := io.Copy(f, io.LimitReader(file, maxSize+1-int64(len(header))))
+	if err != nil {
+		return 0, readError(err)
+	}
+	size := int64(len(header)) + written
+	if size > maxSize {
+		return 0, &FileTooLargeError{Size: size, MaxSize: maxSize}
+	}
+
+	if err := f.Sync(); err != nil {
+		return 0, &StorageError{Op: "save", Err: err}
+	}
+	return size, nil
+}
+
+// Get 获取任务状态
+// user 不为 nil 时只能查询自己提交的任务 (管理员除外)
+func (s *JobService) Get(ctx context.Context, user *model.User, id string) (*model.Job, error) {
+	record, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess(user, record.Options.OwnerID) {
+		return nil, ErrJobNotFound
+	}
+	return &record.Job, nil
+}
+
+// worker 后台处理协程
+func (s *JobService) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case id := <-s.queue:
+			s.process(id)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// process 处理单个任务
+// 处理池已满时等待后重试；服务停止时任务恢复为 pending，下次启动继续处理
+func (s *JobService) process(id string) {
+	record, err := s.update(id, func(r *jobRecord) { r.Status = model.JobProcessing })
+	if err != nil {
+		log.Printf("[WARN] failed to start job %s: %v", id, err)
+		return
+	}
+
+	var result *model.UploadResult
+	for {
+		result, err = s.upload(record)
+
+		var busyErr *ServerBusyError
+		if !errors.As(err, &busyErr) {
+			break
+		}
+		select {
+		case <-time.After(busyErr.RetryAfter):
+		case <-s.stop:
+		}
+		if s.stopCtx.Err() != nil {
+			break
+		}
+	}
+
+	if s.stopCtx.Err() != nil && err != nil {
+		if _, err := s.update(id, func(r *jobRecord) { r.Status = model.JobPending }); err != nil {
+			log.Printf("[WARN] failed to save job %s: %v", id, err)
+		}
+		return
+	}
+
+	_, saveErr := s.update(id, func(r *jobRecord) {
+		if err != nil {
+			code := s.errorCode(err)
+			message, masked := model.MaskedErrorMessage(code)
+			if masked {
+				// 与同步上传一致，可能包含内部信息的错误只记录到日志
+				log.Printf("[ERROR] job %s failed: %v", id, err)
+			} else {
+				message = err.Error()
+			}
+			r.Status = model.JobFailed
+			r.Error = &model.JobError{
+				Code:      code,
+				ErrorCode: model.ErrorCodeName(code),
+				Message:   message,
+			}
+			return
+		}
+		r.Status = model.JobCompleted
+		r.Result = result
+	})
+	if saveErr != nil {
+		log.Printf("[WARN] failed to save job %s: %v", id, saveErr)
+	}
+	os.Remove(s.dataPath(id))
+}
+
+// upload 读取原图并交给 ImageService 处理
+func (s *JobService) upload(record *jobRecord) (*model.UploadResult, error) {
+	f, err := os.Open(s.dataPath(record.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job data: %w", err)
+	}
+	defer f.Close()
+
+	return s.imageService.Upload(s.stopCtx, f, record.Size, record.Options)
+}
+
+// update 修改并保存任务
+func (s *JobService) update(id string, fn func(r *jobRecord)) (*jobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	fn(record)
+	record.UpdatedAt = time.Now()
+	return record, s.saveJob(record)
+}
+
+// loadJob 读取任务文件
+func (s *JobService) loadJob(id string) (*jobRecord, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, ErrJobNotFound
+	}
+	return readJobFile(s.jobPath(id))
+}
+
+// saveJob 原子保存任务文件
+func (s *JobService) saveJob(record *jobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := s.jobPath(record.ID) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, s.jobPath(record.ID)); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+// remove 删除任务文件
+func (s *JobService) remove(id string) {
+	os.Remove(s.dataPath(id))
+	os.Remove(s.jobPath(id))
+}
+
+// retention 完成或失败的任务保留时长，未配置时默认 24 小时
+func (s *JobService) retention() time.Duration {
+	if s.config.RetentionHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(s.config.RetentionHours) * time.Hour
+}
+
+// cleanupLoop 定期删除超过保留时长的已结束任务
+func (s *JobService) cleanupLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		s.cleanupFinished()
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// cleanupFinished 删除超过保留时长的已结束任务
+func (s *JobService) cleanupFinished() {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(-s.retention())
+	for _, jobFile := range matches {
+		record, err := readJobFile(jobFile)
+		if err != nil {
+			continue
+		}
+		finished := record.Status == model.JobCompleted || record.Status == model.JobFailed
+		if finished && record.UpdatedAt.Before(deadline) {
+			s.mu.Lock()
+			s.remove(record.ID)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// readJobFile 读取并解析任务文件
+func readJobFile(path string) (*jobRecord, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record jobRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// loadPendingJobs 按提交时间列出未完成的任务
+// 上次停止时正在处理的任务同样重新处理
+func loadPendingJobs(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*jobRecord
+	for _, jobFile := range matches {
+		record, err := readJobFile(jobFile)
+		if err != nil {
+			log.Printf("[WARN] skipping invalid job file %s: %v", filepath.Base(jobFile), err)
+			continue
+		}
+		if record.Status == model.JobPending || record.Status == model.JobProcessing {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"image-hosting/internal/model"
+)
+
+// JSONMetadataStore 基于 JSON 文件的元数据存储
+// 全部数据保存在内存中，每次修改重写整个文件
+// 适合小规模部署，数据量较大时建议使用 SQLiteMetadataStore
+type JSONMetadataStore struct {
+	mu       sync.Mutex // 改用互斥锁，确保读写串行
+	images   map[string]*model.Image
+	filePath string
+}
+
+// NewJSONMetadataStore 创建 JSON 元数据存储
+func NewJSONMetadataStore(filePath string) (*JSONMetadataStore, error) {
+	store := &JSONMetadataStore{
+		images:   make(map[string]*model.Image),
+		filePath: filePath,
+	}
+
+	// 尝试加载已有数据
+	if err := store.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// jsonRecord 文件中的单条记录
+// model.Image 的 StoragePath 不参与 JSON 序列化 (不暴露给前端)，在此单独保存；
+// 存储路径无法总是从 URL 推断 (如 S3 带前缀或自定义访问地址)，删除图片时依赖此字段
+type jsonRecord struct {
+	*model.Image
+	StoragePath string `json:"storage_path,omitempty"`
+}
+
+// load 从文件加载元数据（内部方法，调用前需持有锁）
+// 早期版本写入的记录没有 storage_path，删除时再从 URL 推断
+func (s *JSONMetadataStore) loadLocked() error {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	var records map[string]*jsonRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	images := make(map[string]*model.Image, len(records))
+	for id, r := range records {
+		if r == nil || r.Image == nil {
+			continue
+		}
+		r.Image.StoragePath = r.StoragePath
+		images[id] = r.Image
+	}
+	s.images = images
+	return nil
+}
+
+// load 从文件加载元数据
+func (s *JSONMetadataStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+// saveLocked 保存元数据到文件（内部方法，调用前需持有锁）
+func (s *JSONMetadataStore) saveLocked() error {
+	records := make(map[string]jsonRecord, len(s.images))
+	for id, img := range s.images {
+		records[id] = jsonRecord{Image: img, StoragePath: img.StoragePath}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写入临时文件，再原子替换，防止写入中断导致数据损坏
+	tmpFile := s.filePath + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+
+	// 原子替换
+	if err := os.Rename(tmpFile, s.filePath); err != nil {
+		os.Remove(tmpFile) // 清理临时文件
+		return err
+	}
+
+	return nil
+}
+
+// Add 添加图片元数据
+func (s *JSONMetadataStore) Add(ctx context.Context, img *model.Image) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imgCopy := *img
+	s.images[img.ID] = &imgCopy
+	return s.saveLocked()
+}
+
+// Delete 删除图片元数据
+func (s *JSONMetadataStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.images[id]; !ok {
+		return ErrMetadataNotFound
+	}
+	delete(s.images, id)
+	return s.saveLocked()
+}
+
+// List 分页列出图片
+func (s *JSONMetadataStore) List(ctx context.Context, opts ListOptions) ([]*model.Image, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	images := make([]*model.Image, 0, len(s.images))
+	for _, img := range s.images {
+		if opts.Format != "" && img.OriginalFormat != opts.Format {
+			continue
+		}
+		if opts.OwnerID != "" && img.OwnerID != opts.OwnerID {
+			continue
+		}
+		// 复制一份，避免外部修改
+		imgCopy := *img
+		images = append(images, &imgCopy)
+	}
+
+	// 按创建时间倒序排列
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].CreatedAt.After(images[j].CreatedAt)
+	})
+
+	total := int64(len(images))
+
+	// 计算分页
+	start := opts.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(images) {
+		start = len(images)
+	}
+	end := len(images)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	return images[start:end], total, nil
+}
+
+// Get 获取图片元数据
+func (s *JSONMetadataStore) Get(ctx context.Context, id string) (*model.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.images[id]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	// 返回副本
+	imgCopy := *img
+	return &imgCopy, nil
+}
+
+// FindByHash 按哈希查找图片
+// 数据全部在内存中，线性扫描即可
+func (s *JSONMetadataStore) FindByHash(ctx context.Context, hash, format, ownerID, visibility string) (*model.Image, error) {
+	if hash == "" {
+		return nil, ErrMetadataNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, img := range s.images {
+		if (img.ContentHash == hash || img.ProcessedHash == hash) && imageFormat(img.Format) == format &&
+			img.OwnerID == ownerID && imageVisibility(img) == visibility {
+			imgCopy := *img
+			return &imgCopy, nil
+		}
+	}
+	return nil, ErrMetadataNotFound
+}
+
+// Count 获取图片总数
+func (s *JSONMetadataStore) Count(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.images)), nil
+}
+
+// Reload 重新从文件加载数据
+func (s *JSONMetadataStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+// Close 释放资源
+// 每次修改都已落盘，无需额外操作
+func (s *JSONMetadataStore) Close() error {
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"image-hosting/internal/model"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrations 数据库结构迁移脚本
+// 按顺序执行，已执行的版本记录在 PRAGMA user_version 中
+// 只能追加，不能修改已发布的脚本
+var sqliteMigrations = []string{
+	// v1: 图片表
+	// data 保存完整的 model.Image JSON，常用查询字段单独成列并建立索引
+	`CREATE TABLE images (
+		id           TEXT PRIMARY KEY,
+		created_at   INTEGER NOT NULL,
+		format       TEXT NOT NULL,
+		storage_path TEXT NOT NULL DEFAULT '',
+		data         TEXT NOT NULL
+	);
+	CREATE INDEX idx_images_created_at ON images (created_at DESC);
+	CREATE INDEX idx_images_format_created_at ON images (format, created_at DESC);`,
+
+	// v2: 内容哈希，用于重复上传检测
+	`ALTER TABLE images ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE images ADD COLUMN processed_hash TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_images_content_hash ON images (content_hash) WHERE content_hash != '';
+	CREATE INDEX idx_images_processed_hash ON images (processed_hash) WHERE processed_hash != '';`,
+
+	// v3: 输出格式，此前的图片均为 WebP
+	`ALTER TABLE images ADD COLUMN output_format TEXT NOT NULL DEFAULT 'webp';`,
+
+	// v4: 上传者，此前的图片不属于任何用户
+	`ALTER TABLE images ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_images_owner_created_at ON images (owner_id, created_at DESC);`,
+
+	// v5: 可见性，此前的图片均为公开
+	`ALTER TABLE images ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';`,
+}
+
+// SQLiteMetadataStore 基于 SQLite 的元数据存储
+// 单条记录读写，不随数据量增长而变慢
+type SQLiteMetadataStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteMetadataStore 创建 SQLite 元数据存储
+// 数据库文件不存在时自动创建并初始化表结构
+func NewSQLiteMetadataStore(path string) (*SQLiteMetadataStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SQLiteMetadataStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return store, nil
+}
+
+// sqliteDSN 生成数据库文件的 URI
+// 路径经过转义，其中的 ?、#、% 等字符不会被当作 URI 的参数或片段
+// WAL 模式允许读写并发，busy_timeout 避免写冲突时立即失败
+func sqliteDSN(path string) string {
+	u := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate",
+	}
+	return u.String()
+}
+
+// migrate 执行未应用的结构迁移
+func (s *SQLiteMetadataStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration v%d: %w", i+1, err)
+		}
+		// PRAGMA 不支持参数绑定
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add 添加图片元数据
+func (s *SQLiteMetadataStore) Add(ctx context.Context, img *model.Image) error {
+	data, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO images (id, created_at, format, output_format, storage_path, content_hash, processed_hash, owner_id, visibility, data)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		img.ID, img.CreatedAt.UnixNano(), img.OriginalFormat, imageFormat(img.Format), img.StoragePath,
+		img.ContentHash, img.ProcessedHash, img.OwnerID, imageVisibility(img), string(data),
+	)
+	return err
+}
+
+// Delete 删除图片元数据
+func (s *SQLiteMetadataStore) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM images WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMetadataNotFound
+	}
+	return nil
+}
+
+// Get 获取图片元数据
+func (s *SQLiteMetadataStore) Get(ctx context.Context, id string) (*model.Image, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT data, storage_path FROM images WHERE id = ?`, id)
+
+	img, err := scanImage(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrMetadataNotFound
+	}
+	return img, err
+}
+
+// FindByHash 按哈希查找图片
+func (s *SQLiteMetadataStore) FindByHash(ctx context.Context, hash, format, ownerID, visibility string) (*model.Image, error) {
+	if hash == "" {
+		return nil, ErrMetadataNotFound
+	}
+
+	row := s.db.QueryRowContext(ctx,
+		`SELECT data, storage_path FROM images
+		 WHERE (content_hash = ? OR processed_hash = ?) AND output_format = ? AND owner_id = ? AND visibility = ?
+		 ORDER BY created_at LIMIT 1`,
+		hash, hash, format, ownerID, visibility,
+	)
+
+	img, err := scanImage(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrMetadataNotFound
+	}
+	return img, err
+}
+
+// List 分页列出图片
+func (s *SQLiteMetadataStore) List(ctx context.Context, opts ListOptions) ([]*model.Image, int64, error) {
+	var conds []string
+	args := []interface{}{}
+	if opts.Format != "" {
+		conds = append(conds, "format = ?")
+		args = append(args, opts.Format)
+	}
+	if opts.OwnerID != "" {
+		conds = append(conds, "owner_id = ?")
+		args = append(args, opts.OwnerID)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM images"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// SQLite 中 LIMIT -1 表示不限制
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT data, storage_path FROM images"+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	images := make([]*model.Image, 0)
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return images, total, nil
+}
+
+// Count 获取图片总数
+func (s *SQLiteMetadataStore) Count(ctx context.Context) (int64, error) {
+	var total int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM images").Scan(&total)
+	return total, err
+}
+
+// Close 关闭数据库
+func (s *SQLiteMetadataStore) Close() error {
+	return s.db.Close()
+}
+
+// rowScanner 兼容 *sql.Row 与 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanImage 读取一行并还原为 model.Image
+// StoragePath 不参与 JSON 序列化，单独存储
+func scanImage(row rowScanner) (*model.Image, error) {
+	var data, storagePath string
+	if err := row.Scan(&data, &storagePath); err != nil {
+		return nil, err
+	}
+
+	var img model.Image
+	if err := json.Unmarshal([]byte(data), &img); err != nil {
+		return nil, err
+	}
+	img.StoragePath = storagePath
+	return &img, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"相对路径", "data/images.db", "file:data/images.db?"},
+		{"绝对路径", "/var/lib/images.db", "file:/var/lib/images.db?"},
+		{"包含 ?", "data/a?b.db", "file:data/a%3Fb.db?"},
+		{"包含 #", "data/a#b.db", "file:data/a%23b.db?"},
+		{"包含 %", "data/a%3Fb.db", "file:data/a%253Fb.db?"},
+		{"包含空格", "my data/images.db", "file:my%20data/images.db?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sqliteDSN(tt.path)
+			want := tt.want + "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+			if got != want {
+				t.Errorf("sqliteDSN(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
+
+// 路径中的特殊字符不影响数据库文件位置与连接参数
+func TestNewSQLiteMetadataStoreSpecialPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a?b#c%20d")
+	path := filepath.Join(dir, "images.db")
+
+	s, err := NewSQLiteMetadataStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteMetadataStore error: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database file not created at %s: %v", path, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("created %d entries in the parent directory, want 1", len(entries))
+	}
+
+	var mode string
+	if err := s.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("PRAGMA journal_mode error: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+}
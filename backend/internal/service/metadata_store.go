@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+)
+
+// ErrMetadataNotFound 元数据不存在
+var ErrMetadataNotFound = errors.New("metadata not found")
+
+// MetadataStore 图片元数据存储接口
+// 目前提供 JSON 文件与 SQLite 两种实现，通过 metadata.type 配置选择
+type MetadataStore interface {
+	// Add 添加或覆盖图片元数据
+	Add(ctx context.Context, img *model.Image) error
+
+	// Delete 删除图片元数据，不存在时返回 ErrMetadataNotFound
+	Delete(ctx context.Context, id string) error
+
+	// Get 获取图片元数据，不存在时返回 ErrMetadataNotFound
+	// 返回的是副本，调用方可以自由修改
+	Get(ctx context.Context, id string) (*model.Image, error)
+
+	// FindByHash 按原始文件或处理后文件的 SHA-256 查找 ownerID 上传的、输出格式为 format、可见性为 visibility 的图片，不存在时返回 ErrMetadataNotFound
+	FindByHash(ctx context.Context, hash, format, ownerID, visibility string) (*model.Image, error)
+
+	// List 按创建时间倒序分页查询，同时返回满足条件的总数
+	List(ctx context.Context, opts ListOptions) ([]*model.Image, int64, error)
+
+	// Count 获取图片总数
+	Count(ctx context.Context) (int64, error)
+
+	// Close 释放资源
+	Close() error
+}
+
+// ListOptions 列表查询条件
+type ListOptions struct {
+	Offset  int    // 跳过的记录数
+	Limit   int    // 返回的最大记录数，<= 0 表示不限制
+	Format  string // 按原始格式过滤 (jpeg/png/webp)，为空表示不过滤
+	OwnerID string // 按上传者过滤，为空表示不过滤
+}
+
+// 元数据存储类型
+const (
+	MetadataTypeJSON   = "json"
+	MetadataTypeSQLite = "sqlite"
+)
+
+// 默认数据文件名，位于存储根目录下
+const (
+	defaultJSONMetadataFile   = "metadata.json"
+	defaultSQLiteMetadataFile = "metadata.db"
+)
+
+// OpenMetadataStore 根据配置创建元数据存储
+// 使用 SQLite 且数据库为空时，自动从同目录下的 metadata.json 迁移一次
+func OpenMetadataStore(ctx context.Context, cfg *config.MetadataConfig, basePath, baseURL string) (MetadataStore, error) {
+	switch cfg.Type {
+	case "", MetadataTypeJSON:
+		path := cfg.Path
+		if path == "" {
+			path = filepath.Join(basePath, defaultJSONMetadataFile)
+		}
+		return NewJSONMetadataStore(path)
+
+	case MetadataTypeSQLite:
+		path := cfg.Path
+		if path == "" {
+			path = filepath.Join(basePath, defaultSQLiteMetadataFile)
+		}
+		store, err := NewSQLiteMetadataStore(path)
+		if err != nil {
+			return nil, err
+		}
+
+		jsonPath := filepath.Join(basePath, defaultJSONMetadataFile)
+		n, err := MigrateJSONMetadata(ctx, jsonPath, store, baseURL)
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to migrate %s: %w", jsonPath, err)
+		}
+		if n > 0 {
+			log.Printf("Migrated %d image records from %s to %s", n, jsonPath, path)
+		}
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported metadata type: %s", cfg.Type)
+	}
+}
+
+// MigrateJSONMetadata 将 metadata.json 中的记录导入目标存储
+// 全部导入成功后将 JSON 文件重命名为 *.migrated，该文件是迁移完成的唯一标记；
+// 中途失败时保留 JSON 文件，下次启动重新导入全部记录，Add 按 ID 覆盖，重复导入不会产生重复记录
+// 返回导入的记录数
+func MigrateJSONMetadata(ctx context.Context, jsonPath string, dst MetadataStore, baseURL string) (int, error) {
+	if _, err := os.Stat(jsonPath); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	src, err := NewJSONMetadataStore(jsonPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	images, _, err := src.List(ctx, ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, img := range images {
+		// 早期版本的 JSON 文件不保存 StoragePath，迁移时从 URL 推断
+		if img.StoragePath == "" {
+			img.StoragePath = storagePathFromURL(img.URL, baseURL)
+		}
+		if err := dst.Add(ctx, img); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(jsonPath, jsonPath+".migrated"); err != nil {
+		return 0, err
+	}
+
+	return len(images), nil
+}
+
+// storagePathFromURL 从访问 URL 推断存储路径
+// URL 格式: {baseURL}/年/月/文件名.webp
+func storagePathFromURL(url, baseURL string) string {
+	prefix := strings.TrimSuffix(baseURL, "/") + "/"
+	if len(url) > len(prefix) && strings.HasPrefix(url, prefix) {
+		return url[len(prefix):]
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+	"image-hosting/internal/storage"
+)
+
+// originalsDir 原图的存储目录
+// 该目录下的文件不通过 /images 公开访问，只能经鉴权的下载接口获取
+const originalsDir = "originals"
+
+// originalPath 由处理后图片的存储路径得到原图的存储路径
+// 如 2024/12/uuid.webp -> originals/2024/12/uuid.jpeg
+func originalPath(storagePath, originalFormat string) string {
+	ext := path.Ext(storagePath)
+	return originalsDir + "/" + strings.TrimSuffix(storagePath, ext) + "." + originalFormat
+}
+
+// isOriginalPath 是否为原图目录下的路径
+func isOriginalPath(p string) bool {
+	return strings.HasPrefix(p, originalsDir+"/")
+}
+
+// validateKeepOriginal 检查能否保存原图
+// 原图与处理后的图片保存在同一存储中，路径可由图片信息推出；
+// storage.base_url 为绝对地址 (存储桶、CDN 等) 时存储可直接公开访问，原图 (含 GPS 等完整 EXIF) 会绕过鉴权泄露
+func validateKeepOriginal(cfg *config.Config) error {
+	if cfg.Image.KeepOriginal && !servedLocally(cfg.Storage.BaseURL) {
+		return fmt.Errorf("image.keep_original requires storage.base_url to be a path served by this server (e.g. /images), got %q",
+			cfg.Storage.BaseURL)
+	}
+	return nil
+}
+
+// saveOriginal 保存上传的原图，返回存储路径
+func (s *ImageService) saveOriginal(ctx context.Context, storagePath, originalFormat string, spool *uploadSpool) (string, error) {
+	p := originalPath(storagePath, originalFormat)
+	if _, err := s.storage.Save(ctx, p, spool.Reader()); err != nil {
+		return "", &StorageError{Op: "save", Err: fmt.Errorf("original: %w", err)}
+	}
+	return p, nil
+}
+
+// OpenOriginal 打开图片上传时保存的原图
+// 返回原图内容与下载文件名；未保存原图时返回 ErrOriginalNotFound
+// 原图按上传时的字节原样返回，不受 image.exif.policy 影响 (可能包含 GPS 位置)
+// 与 GetImage 相同，user 不为 nil 时只能下载自己上传的图片 (管理员除外)
+func (s *ImageService) OpenOriginal(ctx context.Context, user *model.User, id string) (*ServedImage, string, error) {
+	img, err := s.GetImage(ctx, user, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !img.HasOriginal {
+		return nil, "", ErrOriginalNotFound
+	}
+
+	storagePath := img.StoragePath
+	if storagePath == "" {
+		storagePath = storagePathFromURL(img.URL, s.config.Storage.BaseURL)
+	}
+	p := originalPath(storagePath, img.OriginalFormat)
+
+	info, err := s.storage.Stat(ctx, p)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			return nil, "", ErrOriginalNotFound
+		}
+		return nil, "", &StorageError{Op: "open", Err: err}
+	}
+	reader, err := s.storage.Open(ctx, p)
+	if err != nil {
+		return nil, "", &StorageError{Op: "open", Err: err}
+	}
+
+	return &ServedImage{
+		Reader:      reader,
+		ContentType: contentTypeFromPath(p),
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+	}, path.Base(p), nil
+}
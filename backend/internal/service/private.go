@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+)
+
+// 私有图片相关错误
+var (
+	ErrInvalidVisibility = errors.New("invalid visibility")
+	ErrInvalidSignature  = errors.New("invalid or expired signature")
+)
+
+// PrivateURLPrefix 私有图片签名地址的路径前缀
+const PrivateURLPrefix = "/private"
+
+// URLSigner 私有图片访问地址签名
+// 签名为 HMAC-SHA256(存储路径 + "\n" + 过期时间戳)，缩放参数不参与签名，
+// 持有地址的人可以在有效期内访问该图片允许的任意变体
+type URLSigner struct {
+	key        []byte
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// NewURLSigner 创建签名器
+// 未配置密钥时随机生成，服务重启后此前签发的地址全部失效
+func NewURLSigner(cfg *config.PrivateConfig) (*URLSigner, error) {
+	key := []byte(cfg.SigningKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		log.Printf("[WARN] image.private.signing_key is empty, using a random key; signed urls expire on restart")
+	}
+
+	defaultTTL := time.Duration(cfg.DefaultTTLSecs) * time.Second
+	maxTTL := time.Duration(cfg.MaxTTLSecs) * time.Second
+	if defaultTTL <= 0 || maxTTL <= 0 || defaultTTL > maxTTL {
+		return nil, fmt.Errorf("invalid private url ttl: default %ds, max %ds", cfg.DefaultTTLSecs, cfg.MaxTTLSecs)
+	}
+
+	return &URLSigner{key: key, defaultTTL: defaultTTL, maxTTL: maxTTL}, nil
+}
+
+// signature 计算签名
+func (s *URLSigner) signature(storagePath string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(storagePath + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign 生成签名地址: /private/{storagePath}?expires={unix}&sig={hex}
+func (s *URLSigner) sign(storagePath string, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", s.signature(storagePath, expires))
+	return PrivateURLPrefix + "/" + storagePath + "?" + query.Encode()
+}
+
+// Verify 校验签名地址，签名错误或已过期时返回 ErrInvalidSignature
+func (s *URLSigner) Verify(storagePath, expires, sig string) error {
+	ts, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > ts {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(storagePath, ts))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// resolveVisibility 解析可见性参数，为空时为公开
+// 私有图片只能由本服务拒绝公开访问: storage.base_url 为绝对地址 (存储桶、CDN 或其他静态文件服务) 时，
+// 图片地址不经过本服务，无法保证私有，拒绝上传私有图片
+func (s *ImageService) resolveVisibility(visibility string) (string, error) {
+	switch strings.ToLower(visibility) {
+	case "", model.VisibilityPublic:
+		return model.VisibilityPublic, nil
+	case model.VisibilityPrivate:
+		if !servedLocally(s.config.Storage.BaseURL) {
+			return "", fmt.Errorf("%w: private images require storage.base_url to be a path served by this server (e.g. /images), got %q",
+				ErrInvalidVisibility, s.config.Storage.BaseURL)
+		}
+		return model.VisibilityPrivate, nil
+	default:
+		return "", fmt.Errorf("%w: %q (expected public or private)", ErrInvalidVisibility, visibility)
+	}
+}
+
+// servedLocally 访问地址是否为本服务的路径 (而不是其他域名的绝对地址)
+func servedLocally(baseURL string) bool {
+	return strings.HasPrefix(baseURL, "/") && !strings.HasPrefix(baseURL, "//")
+}
+
+// publicImage 返回给客户端的图片信息
+// 私有图片的 /images 地址访问时返回 404，不返回图片与缩略图地址，需通过签名地址访问
+func publicImage(img *model.Image) *model.Image {
+	if !img.IsPrivate() {
+		return img
+	}
+	imgCopy := *img
+	imgCopy.URL, imgCopy.Thumbnails = hidePrivateURLs(img)
+	return &imgCopy
+}
+
+// hidePrivateURLs 私有图片返回空地址与去掉地址的缩略图列表，公开图片原样返回
+func hidePrivateURLs(img *model.Image) (string, []model.Thumbnail) {
+	if !img.IsPrivate() {
+		return img.URL, img.Thumbnails
+	}
+	var thumbnails []model.Thumbnail
+	for _, t := range img.Thumbnails {
+		t.URL = ""
+		thumbnails = append(thumbnails, t)
+	}
+	return "", thumbnails
+}
+
+// ImageInfo 获取返回给客户端的单张图片信息，私有图片不包含访问地址
+// 访问控制与 GetImage 相同
+func (s *ImageService) ImageInfo(ctx context.Context, user *model.User, id string) (*model.Image, error) {
+	img, err := s.GetImage(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	return publicImage(img), nil
+}
+
+// imageVisibility 图片的可见性，未记录时为公开
+func imageVisibility(img *model.Image) string {
+	if img.IsPrivate() {
+		return model.VisibilityPrivate
+	}
+	return model.VisibilityPublic
+}
+
+// Signer 获取私有图片签名器
+func (s *ImageService) Signer() *URLSigner {
+	return s.signer
+}
+
+// SignURL 为图片生成带签名的临时访问地址，同时签发全部缩略图的地址
+// ttl 为 0 时使用 image.private.default_ttl_secs，超过 max_ttl_secs 时按上限处理
+// 与 GetImage 相同，user 不为 nil 时只能为自己上传的图片签名 (管理员除外)
+func (s *ImageService) SignURL(ctx context.Context, user *model.User, id string, ttl time.Duration) (*model.SignedURL, error) {
+	img, err := s.GetImage(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePath := img.StoragePath
+	if storagePath == "" {
+		storagePath = storagePathFromURL(img.URL, s.config.Storage.BaseURL)
+	}
+	if !isValidStoragePath(storagePath) {
+		return nil, ErrImageNotFound
+	}
+
+	if ttl <= 0 {
+		ttl = s.signer.defaultTTL
+	}
+	if ttl > s.signer.maxTTL {
+		ttl = s.signer.maxTTL
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	signed := &model.SignedURL{
+		URL:       s.signer.sign(storagePath, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	if len(img.Thumbnails) > 0 {
+		signed.Thumbnails = make(map[string]string, len(img.Thumbnails))
+		for _, t := range img.Thumbnails {
+			signed.Thumbnails[t.Name] = s.signer.sign(thumbnailPath(storagePath, t.Name), expiresAt)
+		}
+	}
+	return signed, nil
+}
+
+// IsPrivatePath 存储路径是否属于私有图片 (主图或缩略图)
+// 文件名以图片 ID 开头；找不到对应元数据的文件按公开处理
+func (s *ImageService) IsPrivatePath(ctx context.Context, storagePath string) (bool, error) {
+	name := path.Base(storagePath)
+	id := name
+	if i := strings.IndexAny(name, "._"); i >= 0 {
+		id = name[:i]
+	}
+	if id == "" {
+		return false, nil
+	}
+
+	img, err := s.metadata.Get(ctx, id)
+	if errors.Is(err, ErrMetadataNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	return img.IsPrivate(), nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+)
+
+func newTestURLSigner(t *testing.T, key string) *URLSigner {
+	t.Helper()
+	s, err := NewURLSigner(&config.PrivateConfig{SigningKey: key, DefaultTTLSecs: 60, MaxTTLSecs: 3600})
+	if err != nil {
+		t.Fatalf("NewURLSigner error: %v", err)
+	}
+	return s
+}
+
+// parseSignedURL 拆出签名地址中的存储路径、过期时间与签名
+func parseSignedURL(t *testing.T, signed string) (storagePath, expires, sig string) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error: %v", signed, err)
+	}
+	if !strings.HasPrefix(u.Path, PrivateURLPrefix+"/") {
+		t.Fatalf("signed url %q does not start with %s/", signed, PrivateURLPrefix)
+	}
+	return strings.TrimPrefix(u.Path, PrivateURLPrefix+"/"), u.Query().Get("expires"), u.Query().Get("sig")
+}
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := newTestURLSigner(t, "key-1")
+	const p = "2024/12/0b0e3c1a-4a1e-4d3c-9c53-8d0c6f3b9a10.webp"
+
+	path, expires, sig := parseSignedURL(t, signer.sign(p, time.Now().Add(time.Minute)))
+	if path != p {
+		t.Fatalf("signed path = %q, want %q", path, p)
+	}
+	_, expiredTS, expiredSig := parseSignedURL(t, signer.sign(p, time.Now().Add(-time.Second)))
+	_, _, otherPathSig := parseSignedURL(t, signer.sign("2024/12/other.webp", time.Now().Add(time.Minute)))
+	ts, _ := strconv.ParseInt(expires, 10, 64)
+
+	// 最后一位换成另一个十六进制字符
+	tampered := sig[:len(sig)-1] + "0"
+	if tampered == sig {
+		tampered = sig[:len(sig)-1] + "1"
+	}
+
+	tests := []struct {
+		name    string
+		signer  *URLSigner
+		path    string
+		expires string
+		sig     string
+		wantErr bool
+	}{
+		{"有效签名", signer, p, expires, sig, false},
+		{"已过期", signer, p, expiredTS, expiredSig, true},
+		{"篡改签名", signer, p, expires, tampered, true},
+		{"签名大小写不同", signer, p, expires, strings.ToUpper(sig), true},
+		{"空签名", signer, p, expires, "", true},
+		{"延长过期时间", signer, p, strconv.FormatInt(ts+3600, 10), sig, true},
+		{"过期时间不是数字", signer, p, "tomorrow", sig, true},
+		{"用于其他图片", signer, "2024/12/other.webp", expires, sig, true},
+		{"其他图片的签名", signer, p, expires, otherPathSig, true},
+		{"用于缩略图", signer, strings.TrimSuffix(p, ".webp") + "_small.webp", expires, sig, true},
+		{"其他密钥", newTestURLSigner(t, "key-2"), p, expires, sig, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.signer.Verify(tt.path, tt.expires, tt.sig)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Verify error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestNewURLSignerInvalidTTL(t *testing.T) {
+	tests := []config.PrivateConfig{
+		{DefaultTTLSecs: 0, MaxTTLSecs: 60},
+		{DefaultTTLSecs: 60, MaxTTLSecs: 0},
+		{DefaultTTLSecs: 120, MaxTTLSecs: 60},
+	}
+	for _, cfg := range tests {
+		if _, err := NewURLSigner(&cfg); err == nil {
+			t.Errorf("NewURLSigner(default %d, max %d) succeeded, want error", cfg.DefaultTTLSecs, cfg.MaxTTLSecs)
+		}
+	}
+}
+
+func TestSignURL(t *testing.T) {
+	s := newTestImageService(t, newTestConfig(t))
+	ctx := context.Background()
+	img := uploadTestImage(t, s, testPNG(t, 64, 48, color.RGBA{R: 255, A: 255}), UploadOptions{Visibility: model.VisibilityPrivate})
+
+	// 超过 max_ttl_secs 时按上限处理
+	signed, err := s.SignURL(ctx, nil, img.ID, 365*24*time.Hour)
+	if err != nil {
+		t.Fatalf("SignURL error: %v", err)
+	}
+	if maxExpires := time.Now().Add(s.signer.maxTTL); signed.ExpiresAt.After(maxExpires) {
+		t.Errorf("ExpiresAt = %v, want no later than %v", signed.ExpiresAt, maxExpires)
+	}
+
+	path, expires, sig := parseSignedURL(t, signed.URL)
+	if path != img.StoragePath {
+		t.Errorf("signed path = %q, want %q", path, img.StoragePath)
+	}
+	if err := s.Signer().Verify(path, expires, sig); err != nil {
+		t.Errorf("Verify(image) error: %v", err)
+	}
+
+	if len(signed.Thumbnails) != len(img.Thumbnails) {
+		t.Fatalf("got %d signed thumbnails, want %d", len(signed.Thumbnails), len(img.Thumbnails))
+	}
+	for name, u := range signed.Thumbnails {
+		path, expires, sig := parseSignedURL(t, u)
+		if path != thumbnailPath(img.StoragePath, name) {
+			t.Errorf("thumbnail %s path = %q, want %q", name, path, thumbnailPath(img.StoragePath, name))
+		}
+		if err := s.Signer().Verify(path, expires, sig); err != nil {
+			t.Errorf("Verify(thumbnail %s) error: %v", name, err)
+		}
+	}
+
+	// 只能为自己上传的图片签名
+	other := &model.User{Username: "bob", Role: model.RoleUser}
+	if _, err := s.SignURL(ctx, other, img.ID, 0); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("SignURL by other user error = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestIsPrivatePath(t *testing.T) {
+	s := newTestImageService(t, newTestConfig(t))
+	ctx := context.Background()
+	private := uploadTestImage(t, s, testPNG(t, 64, 48, color.RGBA{R: 255, A: 255}), UploadOptions{Visibility: model.VisibilityPrivate})
+	public := uploadTestImage(t, s, testPNG(t, 64, 48, color.RGBA{B: 255, A: 255}), UploadOptions{})
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"私有图片", private.StoragePath, true},
+		{"私有图片的缩略图", thumbnailPath(private.StoragePath, "small"), true},
+		{"私有图片的其他扩展名", strings.TrimSuffix(private.StoragePath, ".webp") + ".png", true},
+		{"公开图片", public.StoragePath, false},
+		{"公开图片的缩略图", thumbnailPath(public.StoragePath, "small"), false},
+		{"不存在的图片", "2024/12/00000000-0000-0000-0000-000000000000.webp", false},
+		{"空路径", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.IsPrivatePath(ctx, tt.path)
+			if err != nil {
+				t.Fatalf("IsPrivatePath(%q) error: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("IsPrivatePath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageInfoHidesPrivateURLs(t *testing.T) {
+	s := newTestImageService(t, newTestConfig(t))
+	img := uploadTestImage(t, s, testPNG(t, 64, 48, color.RGBA{G: 255, A: 255}), UploadOptions{Visibility: model.VisibilityPrivate})
+
+	info, err := s.ImageInfo(context.Background(), nil, img.ID)
+	if err != nil {
+		t.Fatalf("ImageInfo error: %v", err)
+	}
+	if info.URL != "" {
+		t.Errorf("URL = %q, want empty", info.URL)
+	}
+	for _, th := range info.Thumbnails {
+		if th.URL != "" {
+			t.Errorf("thumbnail %s URL = %q, want empty", th.Name, th.URL)
+		}
+	}
+	// 不修改保存的元数据
+	if img, _ = s.GetImage(context.Background(), nil, img.ID); img.URL == "" {
+		t.Error("stored image lost its URL")
+	}
+}
+
+func TestPrivateUploadRequiresLocalBaseURL(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Storage.BaseURL = "https://cdn.example.com/images"
+	s := newTestImageService(t, cfg)
+
+	err := s.ValidateOptions(UploadOptions{Visibility: model.VisibilityPrivate})
+	if !errors.Is(err, ErrInvalidVisibility) {
+		t.Errorf("ValidateOptions error = %v, want ErrInvalidVisibility", err)
+	}
+	if err := s.ValidateOptions(UploadOptions{Visibility: "hidden"}); !errors.Is(err, ErrInvalidVisibility) {
+		t.Errorf("ValidateOptions(hidden) error = %v, want ErrInvalidVisibility", err)
+	}
+}
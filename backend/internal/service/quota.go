@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+)
+
+// 配额所属
+const (
+	quotaSubjectUser = "user"
+	quotaSubjectKey  = "key"
+)
+
+// quotaSubject 配额统计对象: 用户或 API Key
+type quotaSubject struct {
+	kind  string
+	id    string
+	quota model.Quota
+}
+
+func (q quotaSubject) key() string {
+	return q.kind + ":" + q.id
+}
+
+// quotaUsage 用量
+// 占用空间与图片数量在启动时根据元数据统计，只有每日上传次数保存在 quota.usage_file
+type quotaUsage struct {
+	Day     string `json:"day"`     // Uploads 所在日期
+	Uploads int64  `json:"uploads"` // 当天上传次数
+
+	bytes   int64
+	images  int64
+	pending int64 // 已通过检查、尚未完成的上传
+}
+
+// QuotaTracker 用户与 API Key 的配额统计
+// 上传开始时预占一次上传与一张图片，保存元数据前在同一把锁内检查占用空间并记账，
+// 并发上传不会超出配额
+type QuotaTracker struct {
+	accounts *AccountService // 为 nil 时不限制
+	path     string
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage // quotaSubject.key() -> 用量
+}
+
+// NewQuotaTracker 创建配额统计，读取每日上传次数并根据元数据统计已占用的空间与图片数量
+func NewQuotaTracker(ctx context.Context, cfg *config.QuotaConfig, accounts *AccountService, metadata MetadataStore) (*QuotaTracker, error) {
+	t := &QuotaTracker{
+		accounts: accounts,
+		path:     cfg.UsageFile,
+		usage:    make(map[string]*quotaUsage),
+	}
+
+	if t.path != "" {
+		data, err := os.ReadFile(t.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &t.usage); err != nil {
+				return nil, fmt.Errorf("invalid usage file %s: %w", t.path, err)
+			}
+		}
+	}
+
+	images, _, err := metadata.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata: %w", err)
+	}
+	for _, img := range images {
+		for _, sub := range t.subjects(img.OwnerID, img.KeyID) {
+			u := t.usageOf(sub.key())
+			u.bytes += storedSize(img)
+			u.images++
+		}
+	}
+
+	return t, nil
+}
+
+// storedSize 图片占用的存储空间，包括缩略图与保存的原图
+func storedSize(img *model.Image) int64 {
+	size := img.ProcessedSize
+	for _, t := range img.Thumbnails {
+		size += t.Size
+	}
+	if img.HasOriginal {
+		size += img.OriginalSize
+	}
+	return size
+}
+
+// subjects 上传涉及的配额统计对象
+// 不属于任何用户且未使用 API Key 的上传不统计
+func (t *QuotaTracker) subjects(ownerID, keyID string) []quotaSubject {
+	var userQuota, keyQuota model.Quota
+	if t.accounts != nil {
+		userQuota, keyQuota = t.accounts.quotaLimits(ownerID, keyID)
+	}
+
+	var subjects []quotaSubject
+	if ownerID != "" {
+		subjects = append(subjects, quotaSubject{kind: quotaSubjectUser, id: ownerID, quota: userQuota})
+	}
+	if keyID != "" {
+		subjects = append(subjects, quotaSubject{kind: quotaSubjectKey, id: keyID, quota: keyQuota})
+	}
+	return subjects
+}
+
+// usageOf 获取用量，不存在时创建，调用前需持有 mu (启动时除外)
+func (t *QuotaTracker) usageOf(key string) *quotaUsage {
+	u, ok := t.usage[key]
+	if !ok {
+		u = &quotaUsage{}
+		t.usage[key] = u
+	}
+	return u
+}
+
+// rollDay 跨天时重置上传次数，调用前需持有 mu
+func (u *quotaUsage) rollDay(now time.Time) {
+	day := now.Format("2006-01-02")
+	if u.Day != day {
+		u.Day = day
+		u.Uploads = 0
+	}
+}
+
+// Check 检查是否还能上传，不预占配额
+// 用于断点续传、异步上传与 URL 上传在接收文件前提前拒绝
+func (t *QuotaTracker) Check(ownerID, keyID string) error {
+	subjects := t.subjects(ownerID, keyID)
+	if len(subjects) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.checkLocked(subjects, time.Now())
+}
+
+// checkLocked 检查上传次数、图片数量与占用空间，调用前需持有 mu
+// 本次上传的大小此时未知，占用空间只检查是否已满
+func (t *QuotaTracker) checkLocked(subjects []quotaSubject, now time.Time) error {
+	for _, sub := range subjects {
+		u := t.usageOf(sub.key())
+		u.rollDay(now)
+
+		q := sub.quota
+		if q.MaxUploadsPerDay > 0 && u.Uploads+u.pending >= q.MaxUploadsPerDay {
+			return &QuotaExceededError{Subject: sub.kind, Limit: "uploads_per_day", Used: u.Uploads, Max: q.MaxUploadsPerDay}
+		}
+		if q.MaxImages > 0 && u.images+u.pending >= q.MaxImages {
+			return &QuotaExceededError{Subject: sub.kind, Limit: "images", Used: u.images, Max: q.MaxImages}
+		}
+		if q.MaxBytes > 0 && u.bytes >= q.MaxBytes {
+			return &QuotaExceededError{Subject: sub.kind, Limit: "bytes", Used: u.bytes, Max: q.MaxBytes}
+		}
+	}
+	return nil
+}
+
+// quotaReservation 一次上传预占的配额
+// 上传结束时必须调用 release；为 nil 表示不统计
+type quotaReservation struct {
+	t        *QuotaTracker
+	subjects []quotaSubject
+	done     bool
+}
+
+// reserve 检查配额并预占一次上传
+func (t *QuotaTracker) reserve(ownerID, keyID string) (*quotaReservation, error) {
+	subjects := t.subjects(ownerID, keyID)
+	if len(subjects) == 0 {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkLocked(subjects, time.Now()); err != nil {
+		return nil, err
+	}
+	for _, sub := range subjects {
+		t.usage[sub.key()].pending++
+	}
+	return &quotaReservation{t: t, subjects: subjects}, nil
+}
+
+// commitImage 记录新保存的图片
+// 加上本次占用的空间超出配额时返回 *QuotaExceededError，不做任何记录
+func (r *quotaReservation) commitImage(size int64) error {
+	if r == nil {
+		return nil
+	}
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, sub := range r.subjects {
+		u := t.usage[sub.key()]
+		if sub.quota.MaxBytes > 0 && u.bytes+size > sub.quota.MaxBytes {
+			return &QuotaExceededError{Subject: sub.kind, Limit: "bytes", Used: u.bytes + size, Max: sub.quota.MaxBytes}
+		}
+	}
+
+	now := time.Now()
+	for _, sub := range r.subjects {
+		u := t.usage[sub.key()]
+		u.rollDay(now)
+		u.bytes += size
+		u.images++
+		u.Uploads++
+		u.pending--
+	}
+	r.done = true
+	t.saveLocked()
+	return nil
+}
+
+// commitDuplicate 记录命中已有图片的上传，只计入上传次数
+func (r *quotaReservation) commitDuplicate() {
+	if r == nil {
+		return
+	}
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, sub := range r.subjects {
+		u := t.usage[sub.key()]
+		u.rollDay(now)
+		u.Uploads++
+		u.pending--
+	}
+	r.done = true
+	t.saveLocked()
+}
+
+// rollbackImage 撤销 commitImage 的记录，用于元数据保存失败
+func (r *quotaReservation) rollbackImage(size int64) {
+	if r == nil {
+		return
+	}
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, sub := range r.subjects {
+		u := t.usage[sub.key()]
+		u.bytes -= size
+		u.images--
+		if u.Uploads > 0 {
+			u.Uploads--
+		}
+	}
+	t.saveLocked()
+}
+
+// release 释放未使用的预占，上传失败时不计入用量
+func (r *quotaReservation) release() {
+	if r == nil || r.done {
+		return
+	}
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, sub := range r.subjects {
+		t.usage[sub.key()].pending--
+	}
+	r.done = true
+}
+
+// removeImage 图片删除后释放占用的空间与图片数量
+func (t *QuotaTracker) removeImage(img *model.Image) {
+	subjects := t.subjects(img.OwnerID, img.KeyID)
+	if len(subjects) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, sub := range subjects {
+		u := t.usageOf(sub.key())
+		u.bytes -= storedSize(img)
+		u.images--
+	}
+}
+
+// Usage 获取用户或 API Key 的用量
+func (t *QuotaTracker) Usage(kind, id string) model.QuotaUsage {
+	var quota model.Quota
+	for _, sub := range t.subjects(ownerOrKey(kind, id)) {
+		if sub.kind == kind {
+			quota = sub.quota
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.usageOf(kind + ":" + id)
+	u.rollDay(time.Now())
+	return model.QuotaUsage{
+		Bytes:        u.bytes,
+		Images:       u.images,
+		UploadsToday: u.Uploads,
+		Quota:        quota,
+	}
+}
+
+// ownerOrKey 按类型返回 subjects 所需的参数
+func ownerOrKey(kind, id string) (ownerID, keyID string) {
+	if kind == quotaSubjectKey {
+		return "", id
+	}
+	return id, ""
+}
+
+// saveLocked 原子保存每日上传次数，调用前需持有 mu
+// 保存失败只记录日志，不影响上传
+func (t *QuotaTracker) saveLocked() {
+	if t.path == "" {
+		return
+	}
+
+	// 只保存当天有上传的记录
+	daily := make(map[string]*quotaUsage)
+	for k, u := range t.usage {
+		if u.Uploads > 0 {
+			daily[k] = u
+		}
+	}
+
+	data, err := json.Marshal(daily)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(t.path), 0755)
+	}
+	if err == nil {
+		tmpFile := t.path + ".tmp"
+		if err = os.WriteFile(tmpFile, data, 0644); err == nil {
+			if err = os.Rename(tmpFile, t.path); err != nil {
+				os.Remove(tmpFile)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to save quota usage: %v", err)
+	}
+}
+
+// Usage 查询用户的配额用量，keyID 不为空时同时返回该 API Key 的用量
+func (s *ImageService) Usage(username, keyID string) *model.UsageReport {
+	report := &model.UsageReport{
+		Username: username,
+		User:     s.quotas.Usage(quotaSubjectUser, username),
+	}
+	if keyID != "" {
+		key := s.quotas.Usage(quotaSubjectKey, keyID)
+		report.KeyID = keyID
+		report.Key = &key
+	}
+	return report
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+)
+
+// remoteUserAgent 下载远程图片时使用的 User-Agent
+const remoteUserAgent = "image-hosting/1.0 (+remote upload)"
+
+// blockedNetworks 默认禁止访问的地址段
+// 除 netip 能识别的回环、私有、链路本地地址外，还包括运营商 NAT、基准测试等保留地址
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// RemoteFetcher 远程图片下载器
+// 通过 URL 上传时由服务端下载图片。连接建立时检查实际连接的 IP，
+// 重定向与 DNS 解析结果同样受限，防止借助服务端访问内网 (SSRF)
+type RemoteFetcher struct {
+	client  *http.Client
+	maxSize int64
+	allow   []netip.Prefix // 允许访问的内网地址段
+}
+
+// NewRemoteFetcher 创建远程图片下载器
+// maxSize 为 image.max_size，image.remote.max_size 未配置或更大时使用该值
+func NewRemoteFetcher(cfg *config.RemoteConfig, maxSize int64) (*RemoteFetcher, error) {
+	f := &RemoteFetcher{maxSize: maxSize}
+	if cfg.MaxSize > 0 && cfg.MaxSize < maxSize {
+		f.maxSize = cfg.MaxSize
+	}
+
+	for _, s := range cfg.AllowNetworks {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote allow_networks entry %q: %w", s, err)
+		}
+		f.allow = append(f.allow, prefix.Masked())
+	}
+
+	timeout := time.Duration(cfg.TimeoutSecs) * time.Second
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects < 0 {
+		maxRedirects = 0
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: f.checkConn,
+	}
+	f.client = &http.Client{
+		Timeout: timeout,
+		// 不使用环境变量中的代理，代理会绕过连接地址检查
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to %s", ErrInvalidRemoteURL, req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return f, nil
+}
+
+// parseRemoteURL 检查并解析远程图片地址
+// 只允许 http / https，返回不含用户名密码的地址用于记录来源
+func parseRemoteURL(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidRemoteURL, rawURL)
+	}
+
+	source := *u
+	source.User = nil
+	return u, source.String(), nil
+}
+
+// Fetch 请求远程图片，返回响应内容，调用方负责关闭
+// 内容超过大小限制时读取返回 *FileTooLargeError，地址被禁止时返回 ErrRemoteURLBlocked
+func (f *RemoteFetcher) Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRemoteURL, err)
+	}
+	req.Header.Set("User-Agent", remoteUserAgent)
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// 地址检查失败、非法重定向等错误被包装在 *url.Error 中
+		if errors.Is(err, ErrRemoteURLBlocked) || errors.Is(err, ErrInvalidRemoteURL) {
+			return nil, err
+		}
+		return nil, &RemoteFetchError{URL: u.Redacted(), Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &RemoteFetchError{URL: u.Redacted(), StatusCode: resp.StatusCode}
+	}
+	if resp.ContentLength > f.maxSize {
+		resp.Body.Close()
+		return nil, &FileTooLargeError{Size: resp.ContentLength, MaxSize: f.maxSize}
+	}
+
+	return &remoteBody{body: resp.Body, url: u.Redacted(), remaining: f.maxSize, maxSize: f.maxSize}, nil
+}
+
+// remoteBody 远程图片内容
+// 超过大小限制时返回 *FileTooLargeError，网络错误包装为 *RemoteFetchError
+type remoteBody struct {
+	body      io.ReadCloser
+	url       string
+	remaining int64 // 还允许读取的字节数
+	maxSize   int64
+}
+
+func (b *remoteBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, &FileTooLargeError{Size: b.maxSize - b.remaining, MaxSize: b.maxSize}
+	}
+	// 多读一个字节用于判断是否超过大小限制
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, &FileTooLargeError{Size: b.maxSize - b.remaining, MaxSize: b.maxSize}
+	}
+	if err != nil && err != io.EOF {
+		err = &RemoteFetchError{URL: b.url, Err: err}
+	}
+	return n, err
+}
+
+func (b *remoteBody) Close() error {
+	return b.body.Close()
+}
+
+// checkConn 在建立连接前检查目标 IP
+// address 为 DNS 解析后的地址，重定向后的每次连接同样经过此检查
+func (f *RemoteFetcher) checkConn(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRemoteURLBlocked, address)
+	}
+	if !f.allowed(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrRemoteURLBlocked, ap.Addr())
+	}
+	return nil
+}
+
+// allowed 地址是否允许访问
+func (f *RemoteFetcher) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range f.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoteEnabled 是否支持通过 URL 上传
+func (s *ImageService) RemoteEnabled() bool {
+	return s.remote != nil
+}
+
+// FetchRemote 请求远程图片
+// 返回图片内容与记录到元数据中的来源地址，调用方负责关闭；调用前应先校验上传参数，避免无效请求产生下载
+func (s *ImageService) FetchRemote(ctx context.Context, rawURL string) (io.ReadCloser, string, error) {
+	if s.remote == nil {
+		return nil, "", fmt.Errorf("%w: remote upload is disabled", ErrInvalidRemoteURL)
+	}
+	u, source, err := parseRemoteURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, err := s.remote.Fetch(ctx, u)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, source, nil
+}
+
+// UploadURL 下载远程图片并上传
+// 下载完成后与普通上传经过相同的处理流程，来源地址记录在图片信息的 source_url 中
+func (s *ImageService) UploadURL(ctx context.Context, rawURL string, opts UploadOptions) (*model.UploadResult, error) {
+	if err := s.ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+
+	body, source, err := s.FetchRemote(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	opts.SourceURL = source
+	return s.Upload(ctx, body, -1, opts)
+}
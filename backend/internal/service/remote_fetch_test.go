@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"image-hosting/internal/config"
+)
+
+func newTestRemoteFetcher(t *testing.T, allow ...string) *RemoteFetcher {
+	t.Helper()
+	f, err := NewRemoteFetcher(&config.RemoteConfig{
+		Enabled:       true,
+		TimeoutSecs:   5,
+		MaxRedirects:  3,
+		AllowNetworks: allow,
+	}, 1<<20)
+	if err != nil {
+		t.Fatalf("NewRemoteFetcher error: %v", err)
+	}
+	return f
+}
+
+func TestRemoteFetcherAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  string
+		allow []string
+		want  bool
+	}{
+		{"公网 IPv4", "93.184.216.34", nil, true},
+		{"公网 IPv6", "2606:2800:220:1:248:1893:25c8:1946", nil, true},
+		{"回环", "127.0.0.1", nil, false},
+		{"回环 (非 .1)", "127.1.2.3", nil, false},
+		{"IPv6 回环", "::1", nil, false},
+		{"未指定地址", "0.0.0.0", nil, false},
+		{"0.0.0.0/8", "0.1.2.3", nil, false},
+		{"RFC1918 10/8", "10.0.0.1", nil, false},
+		{"RFC1918 172.16/12", "172.31.255.255", nil, false},
+		{"RFC1918 192.168/16", "192.168.1.1", nil, false},
+		{"云元数据 (链路本地)", "169.254.169.254", nil, false},
+		{"IPv6 链路本地", "fe80::1", nil, false},
+		{"IPv6 唯一本地", "fd00::1", nil, false},
+		{"组播", "224.0.0.1", nil, false},
+		{"IPv4 映射的回环", "::ffff:127.0.0.1", nil, false},
+		{"IPv4 映射的私有地址", "::ffff:10.0.0.1", nil, false},
+		{"IPv4 映射的元数据地址", "::ffff:169.254.169.254", nil, false},
+		{"运营商 NAT 100.64/10", "100.64.0.1", nil, false},
+		{"100.64/10 之外", "100.128.0.1", nil, true},
+		{"NAT64 64:ff9b::/96", "64:ff9b::7f00:1", nil, false},
+		{"基准测试 198.18/15", "198.19.0.1", nil, false},
+		{"保留 240/4", "250.1.2.3", nil, false},
+		{"allow_networks 放行内网段", "10.1.2.3", []string{"10.1.0.0/16"}, true},
+		{"allow_networks 之外仍禁止", "10.2.0.1", []string{"10.1.0.0/16"}, false},
+		{"allow_networks 放行 IPv4 映射地址", "::ffff:10.1.2.3", []string{"10.1.0.0/16"}, true},
+		{"allow_networks 未对齐的地址段", "192.168.1.9", []string{"192.168.1.1/24"}, true},
+		{"allow_networks 放行回环", "127.0.0.1", []string{"127.0.0.1/32"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestRemoteFetcher(t, tt.allow...)
+			if got := f.allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRemoteFetcherInvalidAllowNetworks(t *testing.T) {
+	_, err := NewRemoteFetcher(&config.RemoteConfig{AllowNetworks: []string{"10.0.0.1"}}, 1<<20)
+	if err == nil {
+		t.Fatal("NewRemoteFetcher accepted an address without prefix length")
+	}
+}
+
+func TestRemoteFetcherBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	_, err := newTestRemoteFetcher(t).Fetch(context.Background(), u)
+	if !errors.Is(err, ErrRemoteURLBlocked) {
+		t.Fatalf("Fetch(%s) error = %v, want ErrRemoteURLBlocked", srv.URL, err)
+	}
+
+	// allow_networks 放行后可以访问
+	body, err := newTestRemoteFetcher(t, "127.0.0.0/8").Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch with allow_networks error: %v", err)
+	}
+	defer body.Close()
+	if data, _ := io.ReadAll(body); string(data) != "secret" {
+		t.Errorf("body = %q, want %q", data, "secret")
+	}
+}
+
+// 允许访问的地址重定向到 127.0.0.1 时，重定向后的连接同样被拒绝
+func TestRemoteFetcherBlocksRedirectToLoopback(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+		w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+
+	// 重定向服务器监听在 127.0.0.2，通过 allow_networks 单独放行
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.2: %v", err)
+	}
+	redirected := false
+	redirector := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+		http.Redirect(w, r, internal.URL+"/latest/meta-data", http.StatusFound)
+	}))
+	redirector.Listener.Close()
+	redirector.Listener = ln
+	redirector.Start()
+	defer redirector.Close()
+
+	u, _ := url.Parse(redirector.URL + "/image.png")
+	_, err = newTestRemoteFetcher(t, "127.0.0.2/32").Fetch(context.Background(), u)
+	if !errors.Is(err, ErrRemoteURLBlocked) {
+		t.Fatalf("Fetch error = %v, want ErrRemoteURLBlocked", err)
+	}
+	if !redirected {
+		t.Error("request did not reach the redirecting server")
+	}
+}
+
+func TestRemoteFetcherRejectsRedirectScheme(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	_, err := newTestRemoteFetcher(t, "127.0.0.0/8").Fetch(context.Background(), u)
+	if !errors.Is(err, ErrInvalidRemoteURL) {
+		t.Fatalf("Fetch error = %v, want ErrInvalidRemoteURL", err)
+	}
+}
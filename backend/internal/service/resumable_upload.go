@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// 断点续传相关错误
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadLocked         = errors.New("upload is locked by another request")
+	ErrUploadTooLarge       = errors.New("upload length exceeds maximum size")
+	ErrUploadCompleted      = errors.New("upload already completed")
+)
+
+// uploadIDPattern 上传 ID 为 UUID，防止通过 ID 访问任意文件
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// UploadSession 断点续传会话
+// 以 JSON 形式保存在 {id}.info，数据追加写入 {id}.bin
+type UploadSession struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`             // 文件总大小
+	Offset    int64             `json:"offset"`             // 已接收字节数
+	Metadata  map[string]string `json:"metadata,omitempty"` // 客户端提供的元数据 (Upload-Metadata)
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`         // 超过此时间未完成的上传会被清理
+	ImageID   string            `json:"image_id,omitempty"` // 上传完成后生成的图片 ID
+	OwnerID   string            `json:"owner_id,omitempty"` // 创建上传的用户，生成的图片属于该用户
+	KeyID     string            `json:"key_id,omitempty"`   // 创建上传时使用的 API Key
+}
+
+// Completed 是否已完成并生成图片
+func (u *UploadSession) Completed() bool {
+	return u.ImageID != ""
+}
+
+// ResumableUploadService 断点续传服务
+// 实现 tus 协议所需的会话管理，文件接收完成后交给 ImageService.Upload 处理
+type ResumableUploadService struct {
+	imageService *ImageService
+	config       *config.TusConfig
+	maxSize      int64
+	dir          string
+
+	mu     sync.Mutex
+	locked map[string]bool // 正在写入的上传，同一上传同时只允许一个请求写入
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewResumableUploadService 创建断点续传服务，并启动过期清理任务
+func NewResumableUploadService(cfg *config.TusConfig, maxSize int64, imageService *ImageService) (*ResumableUploadService, error) {
+	dir, err := filepath.Abs(cfg.UploadDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	s := &ResumableUploadService{
+		imageService: imageService,
+		config:       cfg,
+		maxSize:      maxSize,
+		dir:          dir,
+		locked:       make(map[string]bool),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go s.cleanupLoop(cleanupInterval(cfg))
+
+	return s, nil
+}
+
+// MaxSize 允许的最大上传大小
+func (s *ResumableUploadService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Close 停止清理任务
+func (s *ResumableUploadService) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+// expiration 上传过期时长，未配置时默认 24 小时
+func (s *ResumableUploadService) expiration() time.Duration {
+	if s.config.ExpirationMinutes <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(s.config.ExpirationMinutes) * time.Minute
+}
+
+// infoPath / dataPath 会话文件路径
+func (s *ResumableUploadService) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+func (s *ResumableUploadService) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+// Create 创建上传会话
+// user 为创建上传的用户，未启用鉴权时为 nil
+func (s *ResumableUploadService) Create(ctx context.Context, user *model.User, length int64, metadata map[string]string) (*UploadSession, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("invalid upload length: %d", length)
+	}
+	if length > s.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes (max: %d)", ErrUploadTooLarge, length, s.maxSize)
+	}
+	// 提前校验输出格式、水印参数与配额，避免上传完成后才失败
+	opts, err := uploadOptions(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		opts.OwnerID = user.Username
+		opts.KeyID = user.KeyID
+	}
+	if err := s.imageService.ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &UploadSession{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expiration()),
+		OwnerID:   opts.OwnerID,
+		KeyID:     opts.KeyID,
+	}
+
+	f, err := os.OpenFile(s.dataPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := s.saveSession(session); err != nil {
+		os.Remove(s.dataPath(session.ID))
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Get 获取上传会话
+// user 不为 nil 时只能获取自己创建的上传 (管理员除外)
+func (s *ResumableUploadService) Get(ctx context.Context, user *model.User, id string) (*UploadSession, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+
+	if !session.Completed() && time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadNotFound
+	}
+	if !canAccess(user, session.OwnerID) {
+		return nil, ErrUploadNotFound
+	}
+
+	return &session, nil
+}
+
+// Append 在 offset 处追加数据
+// offset 必须等于已接收的字节数；返回追加后的会话
+// 全部数据接收完成后立即交给图片处理流程，result 不为 nil 表示已生成图片
+func (s *ResumableUploadService) Append(ctx context.Context, user *model.User, id string, offset int64, r io.Reader) (*UploadSession, *model.UploadResult, error) {
+	if !s.lock(id) {
+		return nil, nil, ErrUploadLocked
+	}
+	defer s.unlock(id)
+
+	session, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Completed() {
+		return session, nil, ErrUploadCompleted
+	}
+	if offset != session.Offset {
+		return session, nil, fmt.Errorf("%w: expected %d, got %d", ErrUploadOffsetMismatch, session.Offset, offset)
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 中断时保留已写入的数据，客户端可从新的 offset 继续
+	// 截断到记录的 offset，丢弃上一次中断写入但未记录的数据
+	if err := f.Truncate(session.Offset); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(session.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(r, session.Length-session.Offset))
+	syncErr := f.Sync()
+	f.Close()
+	if syncErr != nil {
+		return nil, nil, syncErr
+	}
+
+	session.Offset += n
+	session.ExpiresAt = time.Now().Add(s.expiration())
+	if err := s.saveSession(session); err != nil {
+		return nil, nil, err
+	}
+	if copyErr != nil {
+		return session, nil, copyErr
+	}
+
+	if session.Offset < session.Length {
+		return session, nil, nil
+	}
+
+	result, err := s.finish(ctx, session)
+	if err != nil {
+		return session, nil, err
+	}
+	return session, result, nil
+}
+
+// finish 处理已接收完整的文件
+// 处理失败时删除会话，客户端需要重新上传；
+// 处理队列已满或请求在排队时取消，保留会话，客户端可以当前 offset 发送空的 PATCH 重试
+func (s *ResumableUploadService) finish(ctx context.Context, session *UploadSession) (*model.UploadResult, error) {
+	opts, err := uploadOptions(session.Metadata)
+	if err != nil {
+		s.remove(session.ID)
+		return nil, err
+	}
+	opts.OwnerID = session.OwnerID
+	opts.KeyID = session.KeyID
+
+	f, err := os.Open(s.dataPath(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.imageService.Upload(ctx, f, session.Length, opts)
+	f.Close()
+	if errors.Is(err, ErrServerBusy) || ctx.Err() != nil {
+		return nil, err
+	}
+	if err != nil {
+		s.remove(session.ID)
+		return nil, err
+	}
+
+	// 保留会话信息直到过期，便于客户端查询结果；数据文件不再需要
+	session.ImageID = result.ID
+	session.ExpiresAt = time.Now().Add(s.expiration())
+	if err := s.saveSession(session); err != nil {
+		log.Printf("[WARN] failed to save completed upload %s: %v", session.ID, err)
+	}
+	os.Remove(s.dataPath(session.ID))
+
+	return result, nil
+}
+
+// Terminate 终止并删除上传
+func (s *ResumableUploadService) Terminate(ctx context.Context, user *model.User, id string) error {
+	if !s.lock(id) {
+		return ErrUploadLocked
+	}
+	defer s.unlock(id)
+
+	if _, err := s.Get(ctx, user, id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// Result 获取已完成上传生成的图片，私有图片不包含访问地址
+func (s *ResumableUploadService) Result(ctx context.Context, user *model.User, id string) (*model.Image, error) {
+	session, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if !session.Completed() {
+		return nil, ErrUploadNotFound
+	}
+	return s.imageService.ImageInfo(ctx, user, session.ImageID)
+}
+
+// saveSession 原子保存会话信息
+func (s *ResumableUploadService) saveSession(session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := s.infoPath(session.ID) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, s.infoPath(session.ID)); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+// remove 删除会话文件
+func (s *ResumableUploadService) remove(id string) error {
+	if err := os.Remove(s.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// lock 获取上传写锁，已被占用时返回 false
+func (s *ResumableUploadService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked[id] {
+		return false
+	}
+	s.locked[id] = true
+	return true
+}
+
+func (s *ResumableUploadService) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locked, id)
+}
+
+// cleanupInterval 清理任务执行间隔，未配置时默认 10 分钟
+func cleanupInterval(cfg *config.TusConfig) time.Duration {
+	if cfg.CleanupIntervalMinutes <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(cfg.CleanupIntervalMinutes) * time.Minute
+}
+
+// cleanupLoop 定期清理过期的上传
+func (s *ResumableUploadService) cleanupLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.cleanupExpired()
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// cleanupExpired 删除全部过期的上传
+func (s *ResumableUploadService) cleanupExpired() {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.info"))
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, infoFile := range matches {
+		id := filepath.Base(infoFile[:len(infoFile)-len(".info")])
+
+		data, err := os.ReadFile(infoFile)
+		if err != nil {
+			continue
+		}
+		var session UploadSession
+		if err := json.Unmarshal(data, &session); err != nil || now.After(session.ExpiresAt) {
+			if !s.lock(id) {
+				continue
+			}
+			if err := s.remove(id); err != nil {
+				log.Printf("[WARN] failed to remove expired upload %s: %v", id, err)
+			}
+			s.unlock(id)
+		}
+	}
+}
+
+// uploadOptions 从 Upload-Metadata 中读取上传参数
+// 键名与表单上传的字段相同: format, watermark, watermark_text 等
+func uploadOptions(metadata map[string]string) (UploadOptions, error) {
+	watermark, err := ParseWatermarkOptions(func(key string) string { return metadata[key] })
+	if err != nil {
+		return UploadOptions{}, err
+	}
+	return UploadOptions{Format: metadata["format"], Watermark: watermark, Visibility: metadata["visibility"]}, nil
+}
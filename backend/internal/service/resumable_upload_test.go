@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"image-hosting/internal/config"
+)
+
+func newTestResumableUploadService(t *testing.T, cfg *config.Config) *ResumableUploadService {
+	t.Helper()
+	s, err := NewResumableUploadService(&cfg.Tus, cfg.Image.MaxSize, newTestImageService(t, cfg))
+	if err != nil {
+		t.Fatalf("NewResumableUploadService error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// errInterrupted 模拟连接中断
+var errInterrupted = errors.New("connection reset")
+
+// interruptedReader 返回 data 后以 errInterrupted 结束，模拟传输到一半断开的请求
+func interruptedReader(data []byte) io.Reader {
+	return io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errInterrupted))
+}
+
+func TestResumableUploadInterruptAndResume(t *testing.T) {
+	s := newTestResumableUploadService(t, newTestConfig(t))
+	ctx := context.Background()
+	data := testPNG(t, 40, 30, color.RGBA{R: 200, G: 100, A: 255})
+	chunk := len(data) / 3
+
+	session, err := s.Create(ctx, nil, int64(len(data)), map[string]string{"filename": "a.png"})
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	// 第一块完整上传
+	session, result, err := s.Append(ctx, nil, session.ID, 0, bytes.NewReader(data[:chunk]))
+	if err != nil || result != nil {
+		t.Fatalf("Append chunk 1: result %v, error %v", result, err)
+	}
+	if session.Offset != int64(chunk) {
+		t.Fatalf("offset after chunk 1 = %d, want %d", session.Offset, chunk)
+	}
+
+	// 第二块传到一半中断，已接收的数据保留
+	half := chunk / 2
+	session, _, err = s.Append(ctx, nil, session.ID, int64(chunk), interruptedReader(data[chunk:chunk+half]))
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("interrupted Append error = %v, want %v", err, errInterrupted)
+	}
+	if session.Offset != int64(chunk+half) {
+		t.Fatalf("offset after interruption = %d, want %d", session.Offset, chunk+half)
+	}
+
+	// 客户端通过 HEAD 查询 offset 后继续
+	session, err = s.Get(ctx, nil, session.ID)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	offset := session.Offset
+
+	// 使用过期的 offset 被拒绝
+	if _, _, err := s.Append(ctx, nil, session.ID, int64(chunk), bytes.NewReader(data[chunk:])); !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Fatalf("Append with stale offset error = %v, want ErrUploadOffsetMismatch", err)
+	}
+
+	// 上一次请求写入了但未记录的数据在续传时被丢弃
+	f, err := os.OpenFile(s.dataPath(session.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open data file: %v", err)
+	}
+	f.Write([]byte("garbage"))
+	f.Close()
+
+	// 从查询到的 offset 上传剩余数据，超出 Upload-Length 的部分被忽略
+	rest := append(append([]byte(nil), data[offset:]...), "trailing"...)
+	session, result, err = s.Append(ctx, nil, session.ID, offset, bytes.NewReader(rest))
+	if err != nil {
+		t.Fatalf("Append rest error: %v", err)
+	}
+	if result == nil {
+		t.Fatal("upload completed without result")
+	}
+	if session.Offset != int64(len(data)) || !session.Completed() {
+		t.Errorf("session = offset %d, completed %v; want %d, true", session.Offset, session.Completed(), len(data))
+	}
+	if result.Width != 40 || result.Height != 30 || result.OriginalFormat != "png" || result.OriginalSize != int64(len(data)) {
+		t.Errorf("result = %dx%d %s %d bytes, want 40x30 png %d bytes",
+			result.Width, result.Height, result.OriginalFormat, result.OriginalSize, len(data))
+	}
+
+	// 上传完成后数据文件被删除，会话保留用于查询结果
+	if _, err := os.Stat(s.dataPath(session.ID)); !os.IsNotExist(err) {
+		t.Errorf("data file still exists after completion: %v", err)
+	}
+	img, err := s.Result(ctx, nil, session.ID)
+	if err != nil {
+		t.Fatalf("Result error: %v", err)
+	}
+	if img.ID != result.ID {
+		t.Errorf("Result image = %s, want %s", img.ID, result.ID)
+	}
+	if _, _, err := s.Append(ctx, nil, session.ID, session.Offset, bytes.NewReader(nil)); !errors.Is(err, ErrUploadCompleted) {
+		t.Errorf("Append after completion error = %v, want ErrUploadCompleted", err)
+	}
+}
+
+// 处理队列已满时保留会话，客户端以当前 offset 发送空的 PATCH 重试
+func TestResumableUploadRetryAfterServerBusy(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Image.Processing.Workers = 1
+	cfg.Image.Processing.QueueSize = 0
+	s := newTestResumableUploadService(t, cfg)
+	ctx := context.Background()
+	data := testPNG(t, 20, 20, color.RGBA{B: 200, A: 255})
+
+	session, err := s.Create(ctx, nil, int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	// 占满处理池
+	pool := s.imageService.pool
+	pool.admitted <- struct{}{}
+
+	session, result, err := s.Append(ctx, nil, session.ID, 0, bytes.NewReader(data))
+	var busy *ServerBusyError
+	if !errors.As(err, &busy) || result != nil {
+		t.Fatalf("Append while busy: result %v, error %v; want *ServerBusyError", result, err)
+	}
+	if session.Offset != int64(len(data)) || session.Completed() {
+		t.Fatalf("session after busy = offset %d, completed %v; want %d, false", session.Offset, session.Completed(), len(data))
+	}
+	if _, err := os.Stat(s.dataPath(session.ID)); err != nil {
+		t.Fatalf("data file removed after busy error: %v", err)
+	}
+
+	// 仍然繁忙时重试同样失败，会话不受影响
+	if _, _, err := s.Append(ctx, nil, session.ID, session.Offset, bytes.NewReader(nil)); !errors.As(err, &busy) {
+		t.Fatalf("retry while busy error = %v, want *ServerBusyError", err)
+	}
+
+	<-pool.admitted
+
+	session, result, err = s.Append(ctx, nil, session.ID, session.Offset, bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("empty PATCH retry error: %v", err)
+	}
+	if result == nil || !session.Completed() {
+		t.Fatal("retry did not complete the upload")
+	}
+	if result.Width != 20 || result.Height != 20 {
+		t.Errorf("result size = %dx%d, want 20x20", result.Width, result.Height)
+	}
+}
+
+// 处理失败时删除会话，客户端需要重新上传
+func TestResumableUploadProcessingFailure(t *testing.T) {
+	s := newTestResumableUploadService(t, newTestConfig(t))
+	ctx := context.Background()
+	data := []byte("this is not an image")
+
+	session, err := s.Create(ctx, nil, int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if _, _, err := s.Append(ctx, nil, session.ID, 0, bytes.NewReader(data)); err == nil {
+		t.Fatal("Append of invalid image succeeded")
+	}
+	if _, err := s.Get(ctx, nil, session.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Get after failure error = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestResumableUploadCreate(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newTestResumableUploadService(t, cfg)
+	ctx := context.Background()
+
+	if _, err := s.Create(ctx, nil, cfg.Image.MaxSize+1, nil); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("Create over max size error = %v, want ErrUploadTooLarge", err)
+	}
+	if _, err := s.Create(ctx, nil, -1, nil); err == nil {
+		t.Error("Create with negative length succeeded")
+	}
+	if _, err := s.Create(ctx, nil, 10, map[string]string{"format": "bmp"}); err == nil {
+		t.Error("Create with unsupported format succeeded")
+	}
+	if _, err := s.Get(ctx, nil, "../../etc/passwd"); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Get with invalid id error = %v, want ErrUploadNotFound", err)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readSeekerAt 可随机读取的上传内容
+// multipart 临时文件、断点续传与异步任务的文件都满足该接口
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// uploadSpool 暂存在磁盘上的上传内容
+// 上传内容边读取边写入临时文件，处理时才读入内存，排队等待处理的上传不占用内存
+type uploadSpool struct {
+	file     io.ReaderAt
+	size     int64
+	mimeType string
+	hash     string   // 原始文件 SHA-256
+	tmp      *os.File // 暂存时创建的临时文件，Close 时删除
+}
+
+// spoolUpload 暂存上传内容
+// 先读取文件头检测类型，不允许的类型不再继续读取；超过 image.max_size 时返回 *FileTooLargeError。
+// 内容本身可随机读取时直接使用，不再复制到临时文件
+func (s *ImageService) spoolUpload(file io.Reader) (*uploadSpool, error) {
+	maxSize := s.config.Image.MaxSize
+
+	if rs, ok := file.(readSeekerAt); ok {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		mimeType, _, err := DetectMimeType(io.NewSectionReader(rs, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if err := s.checkFileType(mimeType); err != nil {
+			return nil, err
+		}
+		if size > maxSize {
+			return nil, &FileTooLargeError{Size: size, MaxSize: maxSize}
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(rs, 0, size)); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return &uploadSpool{
+			file:     rs,
+			size:     size,
+			mimeType: mimeType,
+			hash:     hex.EncodeToString(hash.Sum(nil)),
+		}, nil
+	}
+
+	mimeType, header, err := DetectMimeType(file)
+	if err != nil {
+		return nil, readError(err)
+	}
+	if err := s.checkFileType(mimeType); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "image-upload-*")
+	if err != nil {
+		return nil, &StorageError{Op: "save", Err: err}
+	}
+	spool := &uploadSpool{file: tmp, mimeType: mimeType, tmp: tmp}
+
+	// 多读一个字节用于判断是否超过大小限制
+	hash := sha256.New()
+	w := io.MultiWriter(tmp, hash)
+	src := io.MultiReader(bytes.NewReader(header), io.LimitReader(file, maxSize+1-int64(len(header))))
+	if spool.size, err = io.Copy(w, src); err != nil {
+		spool.Close()
+		return nil, readError(err)
+	}
+	if spool.size > maxSize {
+		spool.Close()
+		return nil, &FileTooLargeError{Size: spool.size, MaxSize: maxSize}
+	}
+
+	spool.hash = hex.EncodeToString(hash.Sum(nil))
+	return spool, nil
+}
+
+// readError 包装读取上传内容时的错误
+// 来源已判定超过大小限制 (如远程图片) 时原样返回
+func readError(err error) error {
+	if errors.Is(err, ErrFileTooLarge) {
+		return err
+	}
+	return fmt.Errorf("failed to read file: %w", err)
+}
+
+// ReadAll 将暂存的内容读入内存
+// 只在占用处理池槽位后调用，同时驻留内存的原图不超过处理并发数
+func (u *uploadSpool) ReadAll() ([]byte, error) {
+	data := make([]byte, u.size)
+	if _, err := u.file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// Reader 从头读取暂存的内容
+func (u *uploadSpool) Reader() io.Reader {
+	return io.NewSectionReader(u.file, 0, u.size)
+}
+
+// Close 删除暂存时创建的临时文件
+func (u *uploadSpool) Close() error {
+	if u.tmp == nil {
+		return nil
+	}
+	u.tmp.Close()
+	return os.Remove(u.tmp.Name())
+}
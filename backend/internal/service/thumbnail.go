@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"path"
+	"regexp"
+	"strings"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/model"
+	"image-hosting/internal/storage"
+)
+
+// thumbnailNamePattern 缩略图名称只允许小写字母、数字、下划线和连字符
+var thumbnailNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// validateThumbnailConfigs 校验缩略图配置
+func validateThumbnailConfigs(thumbs []config.ThumbnailConfig) error {
+	seen := make(map[string]bool, len(thumbs))
+	for _, t := range thumbs {
+		if !thumbnailNamePattern.MatchString(t.Name) {
+			return fmt.Errorf("invalid thumbnail name: %q", t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate thumbnail name: %q", t.Name)
+		}
+		seen[t.Name] = true
+
+		if t.Width < 0 || t.Height < 0 || (t.Width == 0 && t.Height == 0) {
+			return fmt.Errorf("thumbnail %q: width or height must be positive", t.Name)
+		}
+		switch t.Fit {
+		case "", FitCover, FitContain, FitFill:
+		default:
+			return fmt.Errorf("thumbnail %q: invalid fit %q", t.Name, t.Fit)
+		}
+	}
+	return nil
+}
+
+// thumbnailPath 生成缩略图存储路径
+// 与主图同目录: 2024/12/uuid.webp -> 2024/12/uuid_small.webp
+func thumbnailPath(storagePath, name string) string {
+	ext := path.Ext(storagePath)
+	return strings.TrimSuffix(storagePath, ext) + "_" + name + ".webp"
+}
+
+// generateThumbnails 按配置生成并保存缩略图
+// 返回缩略图信息及已保存的路径；失败时已保存的缩略图会被清理
+func (s *ImageService) generateThumbnails(ctx context.Context, img image.Image, storagePath string) ([]model.Thumbnail, []string, error) {
+	thumbs := make([]model.Thumbnail, 0, len(s.config.Image.Thumbnails))
+	saved := make([]string, 0, len(s.config.Image.Thumbnails))
+
+	for _, t := range s.config.Image.Thumbnails {
+		fit := t.Fit
+		if fit == "" {
+			fit = FitCover
+		}
+
+		resized := s.processor.Resize(img, t.Width, t.Height, fit)
+		data, err := s.processor.Encode(resized, FormatWebP, t.Quality)
+		if err != nil {
+			s.deleteFiles(ctx, saved)
+			return nil, nil, processingError(fmt.Errorf("thumbnail %s: %w", t.Name, err))
+		}
+
+		p := thumbnailPath(storagePath, t.Name)
+		url, err := s.storage.Save(ctx, p, bytes.NewReader(data))
+		if err != nil {
+			s.deleteFiles(ctx, saved)
+			return nil, nil, &StorageError{Op: "save", Err: fmt.Errorf("thumbnail %s: %w", t.Name, err)}
+		}
+		saved = append(saved, p)
+
+		bounds := resized.Bounds()
+		thumbs = append(thumbs, model.Thumbnail{
+			Name:   t.Name,
+			URL:    url,
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			Size:   int64(len(data)),
+		})
+	}
+
+	return thumbs, saved, nil
+}
+
+// deleteFiles 尽力删除文件，用于失败回滚和删除图片
+// 文件不存在视为成功，返回遇到的第一个其他错误
+func (s *ImageService) deleteFiles(ctx context.Context, paths []string) error {
+	var firstErr error
+	for _, p := range paths {
+		if err := s.storage.Delete(ctx, p); err != nil && !errors.Is(err, storage.ErrNotExist) && firstErr == nil {
+			firstErr = err
+		}
+		// 清理变体缓存，失败不影响结果
+		s.variants.Purge(ctx, p)
+	}
+	return firstErr
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"image-hosting/internal/config"
+	"image-hosting/internal/storage"
+)
+
+// 变体相关错误
+var (
+	// ErrVariantDisabled 未启用动态缩放
+	ErrVariantDisabled = errors.New("image variants are disabled")
+
+	// ErrVariantNotAllowed 参数不在允许列表内
+	ErrVariantNotAllowed = errors.New("variant parameters not allowed")
+)
+
+// VariantOptions 图片变体参数
+// 零值字段表示不指定
+type VariantOptions struct {
+	Width   int    // 目标宽度
+	Height  int    // 目标高度
+	Fit     string // 缩放模式: cover, contain, fill
+	Quality int    // 输出质量
+	Format  string // 输出格式: webp, jpeg, png, avif
+}
+
+// IsZero 是否未指定任何参数 (即请求原图)
+func (o VariantOptions) IsZero() bool {
+	return o == VariantOptions{}
+}
+
+// cacheName 生成变体缓存文件名
+// 同一组参数始终得到相同的文件名
+func (o VariantOptions) cacheName() string {
+	return fmt.Sprintf("w%d_h%d_%s_q%d.%s", o.Width, o.Height, o.Fit, o.Quality, o.Format)
+}
+
+// ServedImage 待输出的图片文件
+type ServedImage struct {
+	Reader      io.ReadCloser // 文件内容，调用方负责关闭
+	ContentType string        // MIME 类型
+	Size        int64         // 文件大小
+	ModTime     time.Time     // 最后修改时间
+}
+
+// VariantService 图片变体服务
+// 按请求参数对原图缩放、转码，结果缓存在本地磁盘
+// 缓存按原图路径分目录存放: {cache}/{原图路径}/{参数}.{格式}，删除原图时可整体清理
+type VariantService struct {
+	storage   storage.Storage
+	cache     *storage.LocalStorage
+	processor *ImageProcessor
+	pool      *WorkerPool
+	config    *config.VariantConfig
+
+	mu       sync.Mutex
+	inflight map[string]*variantCall // 正在生成的变体，避免并发请求重复处理
+}
+
+// variantCall 一次正在进行的变体生成
+type variantCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewVariantService 创建变体服务
+// pool 与上传处理共用，限制同时进行的解码与编码
+func NewVariantService(cfg *config.VariantConfig, store storage.Storage, processor *ImageProcessor, pool *WorkerPool) (*VariantService, error) {
+	s := &VariantService{
+		storage:   store,
+		processor: processor,
+		pool:      pool,
+		config:    cfg,
+		inflight:  make(map[string]*variantCall),
+	}
+
+	if cfg.Enabled {
+		cache, err := storage.NewLocalStorage(cfg.CachePath, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create variant cache: %w", err)
+		}
+		s.cache = cache
+	}
+
+	return s, nil
+}
+
+// Validate 校验并补全变体参数
+// 每个参数都必须在配置的允许列表内，未配置的列表表示不允许该参数
+func (s *VariantService) Validate(opts VariantOptions) (VariantOptions, error) {
+	if opts.IsZero() {
+		return opts, nil
+	}
+	if !s.config.Enabled {
+		return opts, ErrVariantDisabled
+	}
+
+	if opts.Width != 0 && !containsInt(s.config.Widths, opts.Width) {
+		return opts, &VariantNotAllowedError{Param: "w", Value: strconv.Itoa(opts.Width)}
+	}
+	if opts.Height != 0 && !containsInt(s.config.Heights, opts.Height) {
+		return opts, &VariantNotAllowedError{Param: "h", Value: strconv.Itoa(opts.Height)}
+	}
+	if opts.Quality != 0 && !containsInt(s.config.Qualities, opts.Quality) {
+		return opts, &VariantNotAllowedError{Param: "q", Value: strconv.Itoa(opts.Quality)}
+	}
+	if opts.Format != "" && (!ValidateMimeType(opts.Format, s.config.Formats) || !s.processor.SupportsFormat(opts.Format)) {
+		return opts, &VariantNotAllowedError{Param: "fmt", Value: opts.Format}
+	}
+
+	switch opts.Fit {
+	case "":
+		opts.Fit = FitCover
+	case FitCover, FitContain, FitFill:
+	default:
+		return opts, &VariantNotAllowedError{Param: "fit", Value: opts.Fit}
+	}
+	if opts.Width == 0 && opts.Height == 0 && opts.Fit != FitCover {
+		return opts, fmt.Errorf("%w: fit requires w or h", ErrVariantNotAllowed)
+	}
+
+	return opts, nil
+}
+
+// Negotiates 是否启用内容协商
+func (s *VariantService) Negotiates() bool {
+	return s.cache != nil && s.config.Negotiate
+}
+
+// Negotiate 为未指定输出格式的请求选择客户端支持的格式
+// accepts 判断客户端是否支持某种格式
+// 原图格式受支持时返回空字符串 (保持原格式)；否则依次尝试 AVIF、WebP，最后使用兜底格式
+// 只降级不升级，避免为每张图片生成额外的 AVIF 副本
+func (s *VariantService) Negotiate(storagePath string, accepts func(format string) bool) string {
+	if !s.Negotiates() {
+		return ""
+	}
+
+	source := formatFromPath(storagePath)
+	if source == "" || accepts(source) {
+		return ""
+	}
+
+	for _, f := range []string{FormatAVIF, FormatWebP} {
+		if accepts(f) && s.processor.SupportsFormat(f) {
+			return f
+		}
+	}
+
+	if s.config.FallbackFormat == FormatPNG {
+		return FormatPNG
+	}
+	return FormatJPEG
+}
+
+// complete 补全默认值，保证相同效果的请求命中同一缓存
+// 未指定格式时保持原图格式
+func (s *VariantService) complete(storagePath string, opts VariantOptions) VariantOptions {
+	if opts.Fit == "" {
+		opts.Fit = FitCover
+	}
+	if opts.Format == "" {
+		opts.Format = formatFromPath(storagePath)
+	}
+	if opts.Quality == 0 {
+		opts.Quality = s.processor.DefaultQuality(opts.Format)
+	}
+	return opts
+}
+
+// Open 打开原图或其变体
+// opts 应先经过 Validate；为零值或与原图效果相同时直接返回原图
+func (s *VariantService) Open(ctx context.Context, storagePath string, opts VariantOptions) (*ServedImage, error) {
+	cleaned, err := storage.CleanPath(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只允许访问图片文件，避免暴露存储目录下的元数据等文件；保存的原图只能通过鉴权接口下载
+	if !isValidStoragePath(cleaned) || isOriginalPath(cleaned) {
+		return nil, storage.ErrNotExist
+	}
+
+	if !opts.IsZero() {
+		opts = s.complete(cleaned, opts)
+	}
+	// 不缩放且格式、质量与原图相同时无需生成变体
+	if opts.IsZero() || (opts.Width == 0 && opts.Height == 0 &&
+		opts.Format == formatFromPath(cleaned) && opts.Quality == s.processor.DefaultQuality(opts.Format)) {
+		return s.openFrom(ctx, s.storage, cleaned, contentTypeFromPath(cleaned))
+	}
+	if s.cache == nil {
+		return nil, ErrVariantDisabled
+	}
+
+	cachePath := path.Join(cleaned, opts.cacheName())
+	contentType := formatToMimeType(opts.Format)
+
+	// 命中缓存
+	if img, err := s.openFrom(ctx, s.cache, cachePath, contentType); err == nil {
+		return img, nil
+	} else if !errors.Is(err, storage.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := s.generate(ctx, cleaned, cachePath, opts); err != nil {
+		return nil, err
+	}
+
+	return s.openFrom(ctx, s.cache, cachePath, contentType)
+}
+
+// Purge 清理原图的全部变体缓存
+func (s *VariantService) Purge(ctx context.Context, storagePath string) error {
+	if s.cache == nil {
+		return nil
+	}
+
+	files, err := s.cache.List(ctx, storagePath)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := s.cache.Delete(ctx, f.Path); err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// openFrom 从指定存储打开文件
+func (s *VariantService) openFrom(ctx context.Context, store storage.Storage, p, contentType string) (*ServedImage, error) {
+	info, err := store.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := store.Open(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServedImage{
+		Reader:      reader,
+		ContentType: contentType,
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+	}, nil
+}
+
+// generate 生成变体并写入缓存
+// 同一变体的并发请求只处理一次，其余请求等待结果
+func (s *VariantService) generate(ctx context.Context, storagePath, cachePath string, opts VariantOptions) error {
+	s.mu.Lock()
+	if call, ok := s.inflight[cachePath]; ok {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &variantCall{done: make(chan struct{})}
+	s.inflight[cachePath] = call
+	s.mu.Unlock()
+
+	// 生成过程不受单个请求取消影响，结果可供其他等待者使用
+	call.err = s.render(context.WithoutCancel(ctx), storagePath, cachePath, opts)
+
+	s.mu.Lock()
+	delete(s.inflight, cachePath)
+	s.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// render 读取原图、缩放、编码并写入缓存
+func (s *VariantService) render(ctx context.Context, storagePath, cachePath string, opts VariantOptions) error {
+	reader, err := s.storage.Open(ctx, storagePath)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	var encoded []byte
+	err = s.pool.Do(ctx, func() error {
+		var err error
+		if encoded, err = s.transform(data, opts); err != nil {
+			return processingError(fmt.Errorf("failed to render variant: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.cache.Save(ctx, cachePath, bytes.NewReader(encoded)); err != nil {
+		return &StorageError{Op: "save", Err: err}
+	}
+	return nil
+}
+
+// transform 按变体参数缩放、转码
+// 动图输出 WebP 或 GIF 时保留全部帧，其他格式取第一帧
+func (s *VariantService) transform(data []byte, opts VariantOptions) ([]byte, error) {
+	if opts.Format == FormatWebP || opts.Format == FormatGIF {
+		anim, err := s.processor.DecodeAnimation(data)
+		if err != nil {
+			return nil, err
+		}
+		if anim != nil {
+			anim = anim.Resize(s.processor, opts.Width, opts.Height, opts.Fit)
+			return s.processor.EncodeAnimation(anim, opts.Format, opts.Quality)
+		}
+	}
+
+	img, err := s.processor.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	img = s.processor.Resize(img, opts.Width, opts.Height, opts.Fit)
+	return s.processor.Encode(img, opts.Format, opts.Quality)
+}
+
+// containsInt 判断切片是否包含指定值
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// formatToMimeType 将格式名称转换为 MIME 类型
+func formatToMimeType(format string) string {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	case FormatAVIF:
+		return "image/avif"
+	case FormatGIF:
+		return "image/gif"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// formatFromPath 根据文件扩展名推断图片格式，无法识别时返回空字符串
+func formatFromPath(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	case ".png":
+		return FormatPNG
+	case ".webp":
+		return FormatWebP
+	case ".avif":
+		return FormatAVIF
+	case ".gif":
+		return FormatGIF
+	default:
+		return ""
+	}
+}
+
+// contentTypeFromPath 根据文件扩展名推断 MIME 类型
+func contentTypeFromPath(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".jpg", ".jpeg":
+		return formatToMimeType(FormatJPEG)
+	case ".png":
+		return formatToMimeType(FormatPNG)
+	case ".webp":
+		return formatToMimeType(FormatWebP)
+	case ".avif":
+		return formatToMimeType(FormatAVIF)
+	case ".gif":
+		return formatToMimeType(FormatGIF)
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"image-hosting/internal/config"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// 水印位置
+const (
+	PositionTopLeft     = "top-left"
+	PositionTop         = "top"
+	PositionTopRight    = "top-right"
+	PositionLeft        = "left"
+	PositionCenter      = "center"
+	PositionRight       = "right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottom      = "bottom"
+	PositionBottomRight = "bottom-right"
+)
+
+// watermarkMargin 水印与图片边缘的距离，占图片短边的比例
+const watermarkMargin = 0.02
+
+// Watermark 水印
+// 由 image.watermark 配置创建，上传时可通过 WatermarkOptions 覆盖部分参数
+type Watermark struct {
+	text      string
+	font      *opentype.Font
+	color     color.Color
+	overlay   image.Image // PNG 水印图片，不为 nil 时优先于文字
+	position  string
+	opacity   float64
+	scale     float64
+	minWidth  int
+	minHeight int
+}
+
+// WatermarkOptions 单次上传的水印参数
+// 零值字段使用全局配置
+// 异步任务保存为 JSON，字段名与上传表单一致
+type WatermarkOptions struct {
+	Enabled  *bool   `json:"watermark,omitempty"`          // 是否添加水印，nil 时使用 image.watermark.enabled
+	Text     string  `json:"watermark_text,omitempty"`     // 文字水印内容，指定后替换配置中的文字与图片
+	Position string  `json:"watermark_position,omitempty"` // 位置
+	Opacity  float64 `json:"watermark_opacity,omitempty"`  // 不透明度 (0-1]
+	Scale    float64 `json:"watermark_scale,omitempty"`    // 水印宽度占图片宽度的比例 (0-1]
+}
+
+// ParseWatermarkOptions 解析上传表单或 tus 元数据中的水印参数
+// 字段: watermark (true/false), watermark_text, watermark_position, watermark_opacity, watermark_scale
+func ParseWatermarkOptions(get func(key string) string) (WatermarkOptions, error) {
+	var opts WatermarkOptions
+
+	if v := get("watermark"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: watermark=%s", ErrInvalidWatermark, v)
+		}
+		opts.Enabled = &enabled
+	}
+	opts.Text = strings.TrimSpace(get("watermark_text"))
+	opts.Position = get("watermark_position")
+
+	for _, f := range []struct {
+		key string
+		dst *float64
+	}{
+		{"watermark_opacity", &opts.Opacity},
+		{"watermark_scale", &opts.Scale},
+	} {
+		v := get(f.key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || n > 1 {
+			return opts, fmt.Errorf("%w: %s=%s", ErrInvalidWatermark, f.key, v)
+		}
+		*f.dst = n
+	}
+
+	if opts.Position != "" && !validPosition(opts.Position) {
+		return opts, fmt.Errorf("%w: watermark_position=%s", ErrInvalidWatermark, opts.Position)
+	}
+	return opts, nil
+}
+
+// NewWatermark 根据配置创建水印
+// 配置了字体或水印图片时立即加载，路径错误在启动时报错
+func NewWatermark(cfg *config.WatermarkConfig) (*Watermark, error) {
+	w := &Watermark{
+		text:      strings.TrimSpace(cfg.Text),
+		position:  cfg.Position,
+		opacity:   cfg.Opacity,
+		scale:     cfg.Scale,
+		minWidth:  cfg.MinWidth,
+		minHeight: cfg.MinHeight,
+	}
+
+	if w.position == "" {
+		w.position = PositionBottomRight
+	}
+	if !validPosition(w.position) {
+		return nil, fmt.Errorf("invalid watermark position: %q", cfg.Position)
+	}
+	if w.opacity <= 0 || w.opacity > 1 {
+		return nil, fmt.Errorf("invalid watermark opacity: %v", cfg.Opacity)
+	}
+	if w.scale <= 0 || w.scale > 1 {
+		return nil, fmt.Errorf("invalid watermark scale: %v", cfg.Scale)
+	}
+
+	c, err := parseHexColor(cfg.Color)
+	if err != nil {
+		return nil, err
+	}
+	w.color = c
+
+	if w.font, err = loadFont(cfg.FontPath); err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+
+	if cfg.ImagePath != "" {
+		overlay, err := imaging.Open(cfg.ImagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load watermark image: %w", err)
+		}
+		w.overlay = overlay
+	}
+
+	if cfg.Enabled && w.text == "" && w.overlay == nil {
+		return nil, fmt.Errorf("watermark enabled but neither text nor image_path is set")
+	}
+	return w, nil
+}
+
+// With 返回应用了单次上传参数的水印
+// 未启用时返回 nil
+func (w *Watermark) With(enabled bool, opts WatermarkOptions) (*Watermark, error) {
+	if opts.Enabled != nil {
+		enabled = *opts.Enabled
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	wm := *w
+	if opts.Text != "" {
+		wm.text = opts.Text
+		wm.overlay = nil
+	}
+	if opts.Position != "" {
+		wm.position = opts.Position
+	}
+	if opts.Opacity > 0 {
+		wm.opacity = opts.Opacity
+	}
+	if opts.Scale > 0 {
+		wm.scale = opts.Scale
+	}
+
+	if wm.text == "" && wm.overlay == nil {
+		return nil, fmt.Errorf("%w: watermark_text is required", ErrInvalidWatermark)
+	}
+	return &wm, nil
+}
+
+// Applies 指定尺寸的图片是否需要添加水印
+func (w *Watermark) Applies(width, height int) bool {
+	return w != nil && width >= w.minWidth && height >= w.minHeight
+}
+
+// Apply 为图片添加水印
+// 图片小于最小尺寸时原样返回
+func (w *Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if !w.Applies(bounds.Dx(), bounds.Dy()) {
+		return img
+	}
+	return w.draw(img, w.render(bounds.Dx()))
+}
+
+// ApplyAll 为动图的每一帧添加水印
+// 各帧尺寸相同，水印只渲染一次
+func (w *Watermark) ApplyAll(frames []image.Image) []image.Image {
+	if len(frames) == 0 {
+		return frames
+	}
+	bounds := frames[0].Bounds()
+	if !w.Applies(bounds.Dx(), bounds.Dy()) {
+		return frames
+	}
+
+	mark := w.render(bounds.Dx())
+	result := make([]image.Image, len(frames))
+	for i, frame := range frames {
+		result[i] = w.draw(frame, mark)
+	}
+	return result
+}
+
+// render 按图片宽度生成水印图案
+func (w *Watermark) render(imageWidth int) image.Image {
+	width := int(math.Round(float64(imageWidth) * w.scale))
+	if width < 1 {
+		width = 1
+	}
+	if w.overlay != nil {
+		return imaging.Resize(w.overlay, width, 0, imaging.Lanczos)
+	}
+	return w.renderText(width)
+}
+
+// renderText 将文字渲染为指定宽度的图案
+// 先按固定字号测量宽度，再按比例换算实际字号
+func (w *Watermark) renderText(width int) image.Image {
+	const measureSize = 64
+	advance := measureString(w.font, measureSize, w.text)
+	if advance <= 0 {
+		return image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	}
+
+	face, err := opentype.NewFace(w.font, &opentype.FaceOptions{
+		Size:    measureSize * float64(width) / float64(advance.Round()),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	drawer := &font.Drawer{
+		Src:  image.NewUniform(w.color),
+		Face: face,
+	}
+	textWidth := drawer.MeasureString(w.text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	mark := image.NewNRGBA(image.Rect(0, 0, textWidth, height))
+	drawer.Dst = mark
+	drawer.Dot = fixed.Point26_6{Y: metrics.Ascent}
+	drawer.DrawString(w.text)
+	return mark
+}
+
+// draw 将水印图案按位置与不透明度叠加到图片上
+func (w *Watermark) draw(img image.Image, mark image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	markBounds := mark.Bounds()
+	pt := w.offset(dst.Bounds().Size(), markBounds.Size())
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(w.opacity * 255))})
+	draw.DrawMask(dst, image.Rectangle{Min: pt, Max: pt.Add(markBounds.Size())},
+		mark, markBounds.Min, mask, image.Point{}, draw.Over)
+	return dst
+}
+
+// offset 计算水印左上角坐标
+func (w *Watermark) offset(canvas, mark image.Point) image.Point {
+	margin := int(float64(min(canvas.X, canvas.Y)) * watermarkMargin)
+
+	var x, y int
+	switch w.position {
+	case PositionTopLeft, PositionLeft, PositionBottomLeft:
+		x = margin
+	case PositionTopRight, PositionRight, PositionBottomRight:
+		x = canvas.X - mark.X - margin
+	default:
+		x = (canvas.X - mark.X) / 2
+	}
+	switch w.position {
+	case PositionTopLeft, PositionTop, PositionTopRight:
+		y = margin
+	case PositionBottomLeft, PositionBottom, PositionBottomRight:
+		y = canvas.Y - mark.Y - margin
+	default:
+		y = (canvas.Y - mark.Y) / 2
+	}
+	return image.Pt(x, y)
+}
+
+// validPosition 是否为有效的水印位置
+func validPosition(position string) bool {
+	switch position {
+	case PositionTopLeft, PositionTop, PositionTopRight,
+		PositionLeft, PositionCenter, PositionRight,
+		PositionBottomLeft, PositionBottom, PositionBottomRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// loadFont 加载字体文件，路径为空时使用内置 Go Bold
+// 字体集 (TTC) 使用其中的第一个字体
+func loadFont(path string) (*opentype.Font, error) {
+	if path == "" {
+		return opentype.Parse(gobold.TTF)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("ttcf")) {
+		collection, err := opentype.ParseCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		return collection.Font(0)
+	}
+	return opentype.Parse(data)
+}
+
+// measureString 测量文字在指定字号下的宽度
+func measureString(f *opentype.Font, size float64, text string) fixed.Int26_6 {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72})
+	if err != nil {
+		return 0
+	}
+	defer face.Close()
+	return font.MeasureString(face, text)
+}
+
+// parseHexColor 解析 #rrggbb 或 #rrggbbaa 格式的颜色，为空时返回白色
+func parseHexColor(s string) (color.Color, error) {
+	if s == "" {
+		return color.White, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid watermark color: %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watermark color: %q", s)
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
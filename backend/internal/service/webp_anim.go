@@ -0,0 +1,385 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/chai2010/webp"
+	xwebp "golang.org/x/image/webp"
+)
+
+// WebP 容器格式 (RIFF)
+// 规范: https://developers.google.com/speed/webp/docs/riff_container
+// chai2010/webp 只支持静态图片，动画的封装 (mux) 与解析 (demux) 在此实现:
+// 每一帧单独编码为静态 WebP，取出其中的 ALPH / VP8 / VP8L 块放入 ANMF 块
+
+// VP8X 标志位
+const (
+	vp8xFlagAnimation = 0x02
+	vp8xFlagXMP       = 0x04
+	vp8xFlagEXIF      = 0x08
+	vp8xFlagAlpha     = 0x10
+)
+
+// ANMF 帧标志位
+const (
+	anmfFlagDispose = 0x01 // 显示后将帧区域清除为背景
+	anmfFlagNoBlend = 0x02 // 直接覆盖画布，不做 alpha 混合
+)
+
+// errInvalidWebP WebP 容器格式错误
+var errInvalidWebP = errors.New("invalid webp container")
+
+// riffChunk RIFF 数据块
+type riffChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// parseRIFFChunks 解析 WebP 文件中的全部数据块
+func parseRIFFChunks(data []byte) ([]riffChunk, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidWebP
+	}
+	return parseChunks(data[12:])
+}
+
+// parseChunks 解析连续的数据块
+// 块格式: FourCC (4) + 大小 (4, 小端) + 数据 + 奇数长度时的填充字节
+func parseChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	for len(data) >= 8 {
+		fourCC := string(data[0:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size < 0 || size > len(data)-8 {
+			return nil, errInvalidWebP
+		}
+		chunks = append(chunks, riffChunk{fourCC: fourCC, data: data[8 : 8+size]})
+
+		next := 8 + size + size%2
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return chunks, nil
+}
+
+// appendChunk 追加一个数据块
+func appendChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	var header [8]byte
+	copy(header[0:4], fourCC)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(data)))
+	buf.Write(header[:])
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// wrapRIFF 为数据块加上 RIFF 文件头
+func wrapRIFF(chunks []byte) []byte {
+	out := make([]byte, 12, 12+len(chunks))
+	copy(out[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(4+len(chunks)))
+	copy(out[8:12], "WEBP")
+	return append(out, chunks...)
+}
+
+// putUint24 写入 24 位小端整数
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// uint24 读取 24 位小端整数
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// vp8xChunk 生成 VP8X 块数据
+func vp8xChunk(flags byte, width, height int) []byte {
+	data := make([]byte, 10)
+	data[0] = flags
+	putUint24(data[4:7], width-1)
+	putUint24(data[7:10], height-1)
+	return data
+}
+
+// isAnimatedWebP 判断是否为动画 WebP
+func isAnimatedWebP(data []byte) bool {
+	// RIFF 头 (12) + VP8X 块头 (8) + 标志位
+	return len(data) >= 21 &&
+		string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP" &&
+		string(data[12:16]) == "VP8X" && data[20]&vp8xFlagAnimation != 0
+}
+
+// encodeWebPAnimation 将动画编码为动画 WebP
+// 每一帧都是完整画布，因此使用不混合、不清除的方式逐帧覆盖
+func encodeWebPAnimation(anim *Animation, quality int) ([]byte, error) {
+	var body bytes.Buffer
+	hasAlpha := false
+
+	for i, frame := range anim.Frames {
+		var encoded bytes.Buffer
+		if err := webp.Encode(&encoded, frame, &webp.Options{Quality: float32(quality)}); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		chunks, err := parseRIFFChunks(encoded.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		bounds := frame.Bounds()
+		header := make([]byte, 16)
+		putUint24(header[6:9], bounds.Dx()-1)
+		putUint24(header[9:12], bounds.Dy()-1)
+		putUint24(header[12:15], anim.Delays[i])
+		header[15] = anmfFlagNoBlend
+
+		var payload bytes.Buffer
+		payload.Write(header)
+		for _, c := range chunks {
+			switch c.fourCC {
+			case "ALPH":
+				hasAlpha = true
+				appendChunk(&payload, c.fourCC, c.data)
+			case "VP8 ", "VP8L":
+				appendChunk(&payload, c.fourCC, c.data)
+			}
+		}
+		appendChunk(&body, "ANMF", payload.Bytes())
+	}
+
+	flags := byte(vp8xFlagAnimation)
+	if hasAlpha {
+		flags |= vp8xFlagAlpha
+	}
+
+	var out bytes.Buffer
+	appendChunk(&out, "VP8X", vp8xChunk(flags, anim.Width, anim.Height))
+
+	// 背景色 (BGRA) + 循环次数
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint16(animChunk[4:6], uint16(anim.LoopCount))
+	appendChunk(&out, "ANIM", animChunk)
+
+	out.Write(body.Bytes())
+	return wrapRIFF(out.Bytes()), nil
+}
+
+// decodeWebPAnimation 解码动画 WebP 的全部帧
+// 按帧的混合与清除方式合成完整画布，解码前检查帧数与总像素数 (见 checkAnimationSize)
+func decodeWebPAnimation(data []byte, maxFrames int, maxTotalMegapixels float64) (*Animation, error) {
+	return demuxWebP(data, maxFrames, maxTotalMegapixels, false)
+}
+
+// webpFrameCount 统计动画 WebP 的帧数
+func webpFrameCount(data []byte) (int, error) {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return 0, err
+	}
+	frames := 0
+	for _, c := range chunks {
+		if c.fourCC == "ANMF" {
+			frames++
+		}
+	}
+	return frames, nil
+}
+
+// decodeWebPFirstFrame 只解码动画 WebP 的第一帧
+func decodeWebPFirstFrame(data []byte) (image.Image, error) {
+	anim, err := demuxWebP(data, 0, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return anim.Frames[0], nil
+}
+
+// demuxWebP 解析动画 WebP
+// firstOnly 为 true 时合成第一帧后立即返回
+func demuxWebP(data []byte, maxFrames int, maxTotalMegapixels float64, firstOnly bool) (*Animation, error) {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].fourCC != "VP8X" || len(chunks[0].data) < 10 {
+		return nil, errInvalidWebP
+	}
+
+	anim := &Animation{
+		Width:  uint24(chunks[0].data[4:7]) + 1,
+		Height: uint24(chunks[0].data[7:10]) + 1,
+	}
+
+	frameCount := 0
+	for _, c := range chunks {
+		if c.fourCC == "ANMF" {
+			frameCount++
+		}
+	}
+	if frameCount == 0 {
+		return nil, errInvalidWebP
+	}
+	if err := checkAnimationSize(anim.Width, anim.Height, frameCount, maxFrames, maxTotalMegapixels); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, anim.Width, anim.Height))
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ANIM":
+			if len(c.data) >= 6 {
+				anim.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:6]))
+			}
+		case "ANMF":
+			if len(c.data) < 16 {
+				return nil, errInvalidWebP
+			}
+			x := uint24(c.data[0:3]) * 2
+			y := uint24(c.data[3:6]) * 2
+			w := uint24(c.data[6:9]) + 1
+			h := uint24(c.data[9:12]) + 1
+			duration := uint24(c.data[12:15])
+			flags := c.data[15]
+
+			// 帧必须位于画布内
+			if x+w > anim.Width || y+h > anim.Height {
+				return nil, errInvalidWebP
+			}
+
+			frame, err := decodeANMFFrame(c.data[16:], w, h)
+			if err != nil {
+				return nil, err
+			}
+
+			rect := image.Rect(x, y, x+w, y+h)
+			op := draw.Over
+			if flags&anmfFlagNoBlend != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, frame, frame.Bounds().Min, op)
+
+			snapshot := image.NewNRGBA(canvas.Bounds())
+			copy(snapshot.Pix, canvas.Pix)
+			anim.Frames = append(anim.Frames, snapshot)
+			anim.Delays = append(anim.Delays, duration)
+
+			if firstOnly {
+				return anim, nil
+			}
+			if flags&anmfFlagDispose != 0 {
+				draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return anim, nil
+}
+
+// decodeANMFFrame 解码 ANMF 块中的单帧数据
+// 帧数据重新封装为独立的静态 WebP 后解码
+func decodeANMFFrame(data []byte, width, height int) (image.Image, error) {
+	chunks, err := parseChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	hasAlpha := false
+	for _, c := range chunks {
+		if c.fourCC == "ALPH" {
+			hasAlpha = true
+		}
+	}
+	if hasAlpha {
+		appendChunk(&body, "VP8X", vp8xChunk(vp8xFlagAlpha, width, height))
+	}
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ALPH", "VP8 ", "VP8L":
+			appendChunk(&body, c.fourCC, c.data)
+		}
+	}
+
+	return xwebp.Decode(bytes.NewReader(wrapRIFF(body.Bytes())))
+}
+
+// webpDimensions 读取 WebP 中声明的图片尺寸，不解码像素数据
+// 画布 (VP8X) 与各帧码流中声明的尺寸可能不一致，取其中的最大值
+func webpDimensions(data []byte) (int, int, error) {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width, height int
+	var visit func(chunks []riffChunk) error
+	visit = func(chunks []riffChunk) error {
+		for _, c := range chunks {
+			var w, h int
+			switch c.fourCC {
+			case "VP8X":
+				if len(c.data) < 10 {
+					return errInvalidWebP
+				}
+				w, h = uint24(c.data[4:7])+1, uint24(c.data[7:10])+1
+			case "VP8 ", "VP8L":
+				if w, h, err = bitstreamDimensions(c.fourCC, c.data); err != nil {
+					return err
+				}
+			case "ANMF":
+				if len(c.data) < 16 {
+					return errInvalidWebP
+				}
+				frames, err := parseChunks(c.data[16:])
+				if err != nil {
+					return err
+				}
+				if err := visit(frames); err != nil {
+					return err
+				}
+			}
+			width, height = max(width, w), max(height, h)
+		}
+		return nil
+	}
+	if err := visit(chunks); err != nil {
+		return 0, 0, err
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, errInvalidWebP
+	}
+	return width, height, nil
+}
+
+// bitstreamDimensions 读取 VP8 / VP8L 码流头部中的尺寸
+// VP8: 帧标记 (3) + 起始码 9D 01 2A + 宽 (2) + 高 (2)，各取低 14 位
+// VP8L: 签名 0x2F + 宽-1 (14 位) + 高-1 (14 位)
+func bitstreamDimensions(fourCC string, data []byte) (int, int, error) {
+	switch fourCC {
+	case "VP8 ":
+		if len(data) < 10 || data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+			return 0, 0, errInvalidWebP
+		}
+		w := int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff)
+		return w, h, nil
+	case "VP8L":
+		if len(data) < 5 || data[0] != 0x2f {
+			return 0, 0, errInvalidWebP
+		}
+		bits := binary.LittleEndian.Uint32(data[1:5])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	default:
+		return 0, 0, errInvalidWebP
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// rawChunk 生成块头声明大小为 size、实际数据为 data 的数据块，用于构造错误的文件
+func rawChunk(fourCC string, size uint32, data []byte) []byte {
+	b := make([]byte, 8, 8+len(data))
+	copy(b, fourCC)
+	binary.LittleEndian.PutUint32(b[4:8], size)
+	return append(b, data...)
+}
+
+// buildAnimatedWebP 生成 width×height 画布、frames 个 1×1 帧的动画 WebP
+// 帧内不含图像数据，只能通过容器解析，完整解码会失败
+func buildAnimatedWebP(width, height, frames int) []byte {
+	var body bytes.Buffer
+	appendChunk(&body, "VP8X", vp8xChunk(vp8xFlagAnimation, width, height))
+	appendChunk(&body, "ANIM", make([]byte, 6))
+	for i := 0; i < frames; i++ {
+		appendChunk(&body, "ANMF", make([]byte, 16))
+	}
+	return wrapRIFF(body.Bytes())
+}
+
+func TestParseRIFFChunks(t *testing.T) {
+	riff := func(chunks ...[]byte) []byte {
+		return wrapRIFF(bytes.Join(chunks, nil))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string // 各块的 FourCC 与数据长度
+		wantErr bool
+	}{
+		{"空文件", nil, nil, true},
+		{"文件头不完整", []byte("RIFF\x00\x00\x00\x00WEB"), nil, true},
+		{"不是 RIFF", append([]byte("RIFX"), riff()[4:]...), nil, true},
+		{"不是 WEBP", append(riff()[:8], "WAVE"...), nil, true},
+		{"没有数据块", riff(), nil, false},
+		{"单个数据块", riff(rawChunk("VP8L", 4, []byte("abcd"))), []string{"VP8L:4"}, false},
+		{"奇数长度带填充", riff(rawChunk("EXIF", 3, []byte("abc\x00")), rawChunk("XMP ", 2, []byte("xy"))), []string{"EXIF:3", "XMP :2"}, false},
+		{"奇数长度的最后一块缺少填充", riff(rawChunk("EXIF", 3, []byte("abc"))), []string{"EXIF:3"}, false},
+		{"末尾不足一个块头", riff(rawChunk("VP8L", 2, []byte("ab")), []byte("VP8")), []string{"VP8L:2"}, false},
+		{"块大小超出文件", riff(rawChunk("VP8L", 100, []byte("abcd"))), nil, true},
+		{"块大小为 0xFFFFFFFF", riff(rawChunk("VP8L", 0xFFFFFFFF, []byte("abcd"))), nil, true},
+		{"后续块大小超出文件", riff(rawChunk("VP8X", 2, []byte("ab")), rawChunk("ANMF", 1<<20, nil)), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := parseRIFFChunks(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidWebP) {
+					t.Fatalf("parseRIFFChunks error = %v, want errInvalidWebP", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRIFFChunks error: %v", err)
+			}
+			var got []string
+			for _, c := range chunks {
+				got = append(got, fmt.Sprintf("%s:%d", c.fourCC, len(c.data)))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("chunks = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunks = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWebPFrameCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{"3 帧", buildAnimatedWebP(10, 10, 3), 3, false},
+		{"没有帧", buildAnimatedWebP(10, 10, 0), 0, false},
+		{"301 帧", buildAnimatedWebP(10, 10, 301), 301, false},
+		{"不是 WebP", []byte("GIF89a"), 0, true},
+		{"块大小超出文件", wrapRIFF(rawChunk("ANMF", 1000, make([]byte, 16))), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := webpFrameCount(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("webpFrameCount error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("webpFrameCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebPDimensions(t *testing.T) {
+	w, h, err := webpDimensions(buildAnimatedWebP(50000, 50000, 1))
+	if err != nil {
+		t.Fatalf("webpDimensions error: %v", err)
+	}
+	if w != 50000 || h != 50000 {
+		t.Errorf("webpDimensions = %dx%d, want 50000x50000", w, h)
+	}
+
+	// VP8X 块数据不完整
+	if _, _, err := webpDimensions(wrapRIFF(rawChunk("VP8X", 4, []byte("abcd")))); err == nil {
+		t.Error("webpDimensions accepted a truncated VP8X chunk")
+	}
+	// ANMF 帧头不完整
+	if _, _, err := webpDimensions(wrapRIFF(rawChunk("ANMF", 4, []byte("abcd")))); err == nil {
+		t.Error("webpDimensions accepted a truncated ANMF chunk")
+	}
+}
+
+// 帧数或总像素数超过限制时，在解码任何一帧之前返回错误
+// buildAnimatedWebP 的帧不含图像数据，解码时会返回其他错误
+func TestDecodeWebPAnimationLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"帧数超过上限", buildAnimatedWebP(10, 10, 301), ErrTooManyFrames},
+		{"总像素超过上限", buildAnimatedWebP(4000, 4000, 10), ErrImageTooLarge},
+		{"单帧画布超过上限", buildAnimatedWebP(16384, 16384, 1), ErrImageTooLarge},
+		{"没有帧", buildAnimatedWebP(10, 10, 0), errInvalidWebP},
+		{"不是 VP8X 开头", wrapRIFF(rawChunk("ANMF", 16, make([]byte, 16))), errInvalidWebP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeWebPAnimation(tt.data, 300, 100)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeWebPAnimation error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 帧位于画布外时拒绝
+func TestDecodeWebPAnimationFrameBounds(t *testing.T) {
+	var body bytes.Buffer
+	appendChunk(&body, "VP8X", vp8xChunk(vp8xFlagAnimation, 10, 10))
+	header := make([]byte, 16)
+	putUint24(header[0:3], 5) // x = 10
+	appendChunk(&body, "ANMF", header)
+
+	if _, err := decodeWebPAnimation(wrapRIFF(body.Bytes()), 300, 100); !errors.Is(err, errInvalidWebP) {
+		t.Errorf("decodeWebPAnimation error = %v, want errInvalidWebP", err)
+	}
+}
+
+func TestWebPAnimationRoundTrip(t *testing.T) {
+	anim := &Animation{Width: 8, Height: 6, LoopCount: 0}
+	for _, c := range []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}} {
+		frame := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+		for i := 0; i < len(frame.Pix); i += 4 {
+			frame.Pix[i], frame.Pix[i+1], frame.Pix[i+2], frame.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		anim.Frames = append(anim.Frames, frame)
+		anim.Delays = append(anim.Delays, 100)
+	}
+
+	data, err := encodeWebPAnimation(anim, 90)
+	if err != nil {
+		t.Fatalf("encodeWebPAnimation error: %v", err)
+	}
+	if !isAnimatedWebP(data) {
+		t.Fatal("encoded data is not an animated WebP")
+	}
+	if n, err := webpFrameCount(data); err != nil || n != 3 {
+		t.Fatalf("webpFrameCount = %d, %v; want 3", n, err)
+	}
+
+	decoded, err := decodeWebPAnimation(data, 300, 100)
+	if err != nil {
+		t.Fatalf("decodeWebPAnimation error: %v", err)
+	}
+	if len(decoded.Frames) != 3 || decoded.Width != 8 || decoded.Height != 6 {
+		t.Errorf("decoded %d frames of %dx%d, want 3 frames of 8x6", len(decoded.Frames), decoded.Width, decoded.Height)
+	}
+}
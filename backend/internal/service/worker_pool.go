@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"image-hosting/internal/config"
+)
+
+// WorkerPool 图片处理并发限制
+// 解码与编码占用大量内存，同时处理的任务数不超过 workers，
+// 其余任务排队等待，队列满时立即返回 *ServerBusyError
+type WorkerPool struct {
+	slots      chan struct{} // 处理槽位，容量为 workers
+	admitted   chan struct{} // 处理中与排队中的任务，容量为 workers + queue_size
+	retryAfter time.Duration // 队列满时建议客户端的重试间隔
+}
+
+// NewWorkerPool 创建处理池
+// workers 为 0 时使用 CPU 核数
+func NewWorkerPool(cfg *config.ProcessingConfig) *WorkerPool {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := cfg.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	retryAfter := time.Duration(cfg.RetryAfterSecs) * time.Second
+	if retryAfter <= 0 {
+		retryAfter = 5 * time.Second
+	}
+
+	return &WorkerPool{
+		slots:      make(chan struct{}, workers),
+		admitted:   make(chan struct{}, workers+queueSize),
+		retryAfter: retryAfter,
+	}
+}
+
+// Do 占用一个处理槽位执行 fn
+// 队列已满时返回 *ServerBusyError；排队期间 ctx 取消时放弃执行并返回 ctx.Err()
+func (p *WorkerPool) Do(ctx context.Context, fn func() error) error {
+	select {
+	case p.admitted <- struct{}{}:
+	default:
+		return &ServerBusyError{RetryAfter: p.retryAfter}
+	}
+	defer func() { <-p.admitted }()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	// 等待期间可能已取消，此时不再开始处理
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn()
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tmpFilePrefix 原子写入时使用的临时文件前缀
+// List 会忽略此前缀的文件
+const tmpFilePrefix = ".tmp-"
+
+// LocalStorage 本地磁盘存储
+// 文件保存在 basePath 下，通过静态文件服务以 baseURL 对外提供访问
+type LocalStorage struct {
+	basePath string // 存储根目录 (绝对路径)
+	baseURL  string // 访问 URL 前缀
+}
+
+// NewLocalStorage 创建本地存储
+// basePath 不存在时自动创建
+func NewLocalStorage(basePath, baseURL string) (*LocalStorage, error) {
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path: %w", err)
+	}
+
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorage{
+		basePath: absPath,
+		baseURL:  baseURL,
+	}, nil
+}
+
+// GetBasePath 获取存储根目录
+func (s *LocalStorage) GetBasePath() string {
+	return s.basePath
+}
+
+// resolve 将存储路径转换为磁盘绝对路径
+// 额外校验结果仍位于存储根目录内，防止路径穿越
+func (s *LocalStorage) resolve(p string) (string, error) {
+	cleaned, err := CleanPath(p)
+	if err != nil {
+		return "", err
+	}
+
+	fullPath := filepath.Join(s.basePath, filepath.FromSlash(cleaned))
+	rel, err := filepath.Rel(s.basePath, fullPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || rel == ".." {
+		return "", ErrInvalidPath
+	}
+
+	return fullPath, nil
+}
+
+// Save 保存文件
+// 先写入同目录下的临时文件，fsync 后再重命名，保证写入原子性
+func (s *LocalStorage) Save(ctx context.Context, path string, r io.Reader) (string, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, tmpFilePrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+
+	// 任一步骤失败都要清理临时文件
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	// CreateTemp 创建的文件权限为 0600，调整为与普通文件一致，便于静态服务读取
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	if err := os.Rename(tmpName, fullPath); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	return s.GetURL(path), nil
+}
+
+// Open 打开文件
+func (s *LocalStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 目录不是合法的存储文件
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: path, Err: ErrNotExist}
+	}
+
+	return f, nil
+}
+
+// Stat 获取文件信息
+func (s *LocalStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: ErrNotExist}
+	}
+
+	cleaned, _ := CleanPath(path)
+	return &FileInfo{
+		Path:    cleaned,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Delete 删除文件
+func (s *LocalStorage) Delete(ctx context.Context, path string) error {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "remove", Path: path, Err: ErrNotExist}
+	}
+
+	return os.Remove(fullPath)
+}
+
+// List 列出目录下的所有文件
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	cleaned, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	root := s.basePath
+	if cleaned != "" {
+		root = filepath.Join(s.basePath, filepath.FromSlash(cleaned))
+	}
+
+	files := make([]FileInfo, 0)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpFilePrefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// 遍历过程中文件被删除，忽略
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(s.basePath, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, FileInfo{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		// 目录不存在视为空列表
+		if errors.Is(err, fs.ErrNotExist) {
+			return []FileInfo{}, nil
+		}
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+// Exists 判断文件是否存在
+func (s *LocalStorage) Exists(ctx context.Context, path string) (bool, error) {
+	_, err := s.Stat(ctx, path)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// GetURL 获取文件访问 URL
+func (s *LocalStorage) GetURL(path string) string {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		cleaned = path
+	}
+	return joinURL(s.baseURL, cleaned)
+}
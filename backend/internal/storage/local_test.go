@@ -0,0 +1,18 @@
+package storage_test
+
+import (
+	"testing"
+
+	"image-hosting/internal/storage"
+	"image-hosting/internal/storage/storagetest"
+)
+
+func TestLocalStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewLocalStorage(t.TempDir(), "/images")
+		if err != nil {
+			t.Fatalf("NewLocalStorage error: %v", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,628 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minPartSize S3 要求除最后一个分片外，每个分片至少 5MB
+const minPartSize = 5 * 1024 * 1024
+
+// S3Options S3 兼容存储参数
+type S3Options struct {
+	Endpoint        string        // 服务地址，如 https://s3.amazonaws.com
+	Region          string        // 区域
+	Bucket          string        // 存储桶
+	AccessKeyID     string        // 访问密钥 ID
+	SecretAccessKey string        // 访问密钥
+	PathStyle       bool          // 使用 path-style 寻址: endpoint/bucket/key
+	Prefix          string        // 对象键前缀
+	BaseURL         string        // 对外访问 URL 前缀 (如 CDN 域名)，为空时使用存储桶地址
+	PartSize        int64         // 分片大小，数据超过此大小时使用分片上传
+	Timeout         time.Duration // 单个请求超时时间 (含响应体读取)
+	HTTPClient      *http.Client  // 自定义 HTTP 客户端，为空时使用默认客户端
+}
+
+// S3Storage S3 兼容对象存储
+// 支持 path-style 与 virtual-host 两种寻址方式，使用 SigV4 签名
+// 大文件自动使用分片上传
+type S3Storage struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	baseURL  string
+	partSize int64
+	timeout  time.Duration
+	client   *http.Client
+	signer   *sigV4Signer
+
+	pathStyle bool
+}
+
+// NewS3Storage 创建 S3 兼容存储
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	if opts.Endpoint == "" {
+		return nil, errors.New("s3 endpoint is required")
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid s3 endpoint scheme: %q", endpoint.Scheme)
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	partSize := opts.PartSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	prefix := ""
+	if opts.Prefix != "" {
+		prefix, err = CleanPath(strings.Trim(opts.Prefix, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 prefix: %w", err)
+		}
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	s := &S3Storage{
+		endpoint:  endpoint,
+		bucket:    opts.Bucket,
+		prefix:    prefix,
+		partSize:  partSize,
+		timeout:   opts.Timeout,
+		client:    client,
+		pathStyle: opts.PathStyle,
+		signer: &sigV4Signer{
+			accessKeyID:     opts.AccessKeyID,
+			secretAccessKey: opts.SecretAccessKey,
+			region:          region,
+		},
+	}
+
+	s.baseURL = opts.BaseURL
+	if s.baseURL == "" {
+		// 未配置访问地址时，直接使用对象地址 (要求存储桶可公开读取)
+		u := s.objectURL("")
+		s.baseURL = strings.TrimSuffix(u.String(), "/")
+	}
+
+	return s, nil
+}
+
+// key 将存储路径转换为对象键
+func (s *S3Storage) key(p string) string {
+	if s.prefix == "" {
+		return p
+	}
+	return s.prefix + "/" + p
+}
+
+// objectURL 生成对象请求地址
+// path-style:   {endpoint}/{bucket}/{key}
+// virtual-host: {bucket}.{endpoint host}/{key}
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+
+	var p string
+	if s.pathStyle {
+		p = basePath + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		p = basePath + "/" + key
+	}
+
+	u.Path = p
+	u.RawPath = uriEncode(p, false)
+	return &u
+}
+
+// request 构造、签名并发送请求
+// body 为 nil 表示无请求体，调用方负责关闭响应体
+func (s *S3Storage) request(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	if query != nil {
+		// 使用 SigV4 相同的编码规则，保证签名与实际请求一致
+		u.RawQuery = canonicalQuery(query)
+	}
+
+	var reader io.Reader
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		reader = bytes.NewReader(body)
+		payloadHash = hashHex(body)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	s.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// 响应体读取完成前不能取消 context
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 关闭响应体时释放超时 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// s3Error S3 错误响应
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Unwrap 对象不存在时可被 errors.Is(err, ErrNotExist) 识别
+func (e *s3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound && (e.Code == "" || e.Code == "NoSuchKey") {
+		return ErrNotExist
+	}
+	return nil
+}
+
+// checkResponse 检查响应状态，失败时解析错误并关闭响应体
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	e := &s3Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if len(data) > 0 {
+		xml.Unmarshal(data, e)
+	}
+	return e
+}
+
+// drain 读取并关闭响应体，便于连接复用
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// Save 保存文件
+// 数据不超过一个分片时使用 PutObject，否则使用分片上传
+// 两种方式在 S3 中都是原子的，上传完成前对象不可见
+func (s *S3Storage) Save(ctx context.Context, path string, r io.Reader) (string, error) {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	key := s.key(cleaned)
+
+	first, err := readPart(r, s.partSize)
+	if err != nil {
+		return "", err
+	}
+
+	// 不足一个分片，直接上传
+	if int64(len(first)) < s.partSize {
+		if err := s.putObject(ctx, key, first); err != nil {
+			return "", err
+		}
+		return s.GetURL(cleaned), nil
+	}
+
+	if err := s.multipartUpload(ctx, key, first, r); err != nil {
+		return "", err
+	}
+	return s.GetURL(cleaned), nil
+}
+
+// readPart 读取至多 size 字节
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 64*1024))
+	if _, err := io.CopyN(buf, r, size); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// putObject 单次上传对象
+func (s *S3Storage) putObject(ctx context.Context, key string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", http.DetectContentType(data))
+
+	resp, err := s.request(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// completedPart 已上传的分片
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipartUpload 分片上传
+// 任一步骤失败都会中止上传，避免残留未完成的分片占用空间
+func (s *S3Storage) multipartUpload(ctx context.Context, key string, first []byte, r io.Reader) error {
+	uploadID, err := s.createMultipartUpload(ctx, key, http.DetectContentType(first))
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.uploadParts(ctx, key, uploadID, first, r)
+	if err == nil {
+		err = s.completeMultipartUpload(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		// 使用独立 context 中止，原 context 可能已取消
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s.abortMultipartUpload(abortCtx, key, uploadID)
+		return err
+	}
+
+	return nil
+}
+
+// uploadParts 依次上传全部分片
+func (s *S3Storage) uploadParts(ctx context.Context, key, uploadID string, first []byte, r io.Reader) ([]completedPart, error) {
+	var parts []completedPart
+	data := first
+	for partNumber := 1; len(data) > 0; partNumber++ {
+		etag, err := s.uploadPart(ctx, key, uploadID, partNumber, data)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: etag})
+
+		if int64(len(data)) < s.partSize {
+			break
+		}
+		if data, err = readPart(r, s.partSize); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// createMultipartUpload 初始化分片上传，返回 UploadId
+func (s *S3Storage) createMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := s.request(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResponse(resp); err != nil {
+		return "", err
+	}
+	defer drain(resp)
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("s3: invalid CreateMultipartUpload response: %w", err)
+	}
+	if result.UploadID == "" {
+		return "", errors.New("s3: empty upload id")
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart 上传单个分片，返回 ETag
+func (s *S3Storage) uploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}
+
+	resp, err := s.request(ctx, http.MethodPut, key, query, nil, data)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResponse(resp); err != nil {
+		return "", err
+	}
+	drain(resp)
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("s3: missing ETag for part %d", partNumber)
+	}
+	return etag, nil
+}
+
+// completeMultipartUpload 合并分片
+func (s *S3Storage) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+
+	resp, err := s.request(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, header, body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	defer drain(resp)
+
+	// CompleteMultipartUpload 可能返回 200 但响应体中包含错误
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		e := &s3Error{StatusCode: resp.StatusCode}
+		xml.Unmarshal(data, e)
+		return e
+	}
+	return nil
+}
+
+// abortMultipartUpload 中止分片上传
+func (s *S3Storage) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := s.request(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// Open 打开文件
+func (s *S3Storage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.request(ctx, http.MethodGet, s.key(cleaned), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, wrapPathError("open", cleaned, err)
+	}
+	return resp.Body, nil
+}
+
+// Stat 获取文件信息
+func (s *S3Storage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.request(ctx, http.MethodHead, s.key(cleaned), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, wrapPathError("stat", cleaned, err)
+	}
+	drain(resp)
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &FileInfo{
+		Path:    cleaned,
+		Size:    resp.ContentLength,
+		ModTime: modTime,
+	}, nil
+}
+
+// Delete 删除文件
+// S3 删除不存在的对象也返回成功，因此先检查对象是否存在，保持与本地存储一致的语义
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Stat(ctx, cleaned); err != nil {
+		return err
+	}
+
+	resp, err := s.request(ctx, http.MethodDelete, s.key(cleaned), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		return wrapPathError("remove", cleaned, err)
+	}
+	drain(resp)
+	return nil
+}
+
+// listResult ListObjectsV2 响应
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List 列出目录下的所有文件
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	cleaned, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按目录匹配，前缀以 / 结尾
+	keyPrefix := ""
+	if cleaned != "" {
+		keyPrefix = s.key(cleaned) + "/"
+	} else if s.prefix != "" {
+		keyPrefix = s.prefix + "/"
+	}
+
+	files := make([]FileInfo, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if keyPrefix != "" {
+			query.Set("prefix", keyPrefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		result, err := s.listObjects(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range result.Contents {
+			p := obj.Key
+			if s.prefix != "" {
+				p = strings.TrimPrefix(p, s.prefix+"/")
+			}
+			// 忽略以 / 结尾的 "目录" 占位对象
+			if p == "" || strings.HasSuffix(p, "/") {
+				continue
+			}
+			files = append(files, FileInfo{
+				Path:    p,
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+// listObjects 调用 ListObjectsV2
+func (s *S3Storage) listObjects(ctx context.Context, query url.Values) (*listResult, error) {
+	resp, err := s.request(ctx, http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	defer drain(resp)
+
+	var result listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("s3: invalid ListObjectsV2 response: %w", err)
+	}
+	return &result, nil
+}
+
+// Exists 判断文件是否存在
+func (s *S3Storage) Exists(ctx context.Context, path string) (bool, error) {
+	_, err := s.Stat(ctx, path)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// GetURL 获取文件访问 URL
+func (s *S3Storage) GetURL(path string) string {
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		cleaned = path
+	}
+	return joinURL(s.baseURL, uriEncode(s.key(cleaned), false))
+}
+
+// wrapPathError 包装为 fs.PathError，与本地存储的错误形式保持一致
+func wrapPathError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,103 @@
+// Package storage 提供图片文件存储抽象
+// 业务层只依赖 Storage 接口，具体实现 (本地磁盘、对象存储等) 可按配置替换
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// 预定义错误
+// 各存储实现都应返回 (或包装) 这些错误，便于上层使用 errors.Is 判断
+var (
+	// ErrNotExist 文件不存在
+	// 与 fs.ErrNotExist 相同，因此 os.IsNotExist / errors.Is(err, fs.ErrNotExist) 均可识别
+	ErrNotExist = fs.ErrNotExist
+
+	// ErrInvalidPath 存储路径非法 (空路径、绝对路径、包含 .. 等)
+	ErrInvalidPath = errors.New("invalid storage path")
+)
+
+// FileInfo 存储文件信息
+type FileInfo struct {
+	Path    string    // 相对存储根目录的路径，使用 / 分隔
+	Size    int64     // 文件大小 (bytes)
+	ModTime time.Time // 最后修改时间
+}
+
+// Storage 存储接口
+// 所有 path 参数均为相对存储根的路径，使用 / 分隔，例如 2024/12/uuid.webp
+// 实现必须保证:
+//   - 拒绝越出存储根的路径，返回 ErrInvalidPath
+//   - Save 是原子的: 读取方要么看到完整的新文件，要么看不到
+//   - 文件不存在时 Open / Stat / Delete 返回 ErrNotExist
+//   - 并发调用安全
+type Storage interface {
+	// Save 保存文件，已存在时覆盖，返回文件访问 URL
+	Save(ctx context.Context, path string, r io.Reader) (string, error)
+
+	// Open 打开文件用于读取，调用方负责关闭
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// Stat 获取文件信息
+	Stat(ctx context.Context, path string) (*FileInfo, error)
+
+	// Delete 删除文件
+	Delete(ctx context.Context, path string) error
+
+	// List 列出指定目录下的所有文件 (递归)，按路径排序
+	// prefix 为目录路径，例如 2024/12；为空表示列出全部文件
+	List(ctx context.Context, prefix string) ([]FileInfo, error)
+
+	// Exists 判断文件是否存在
+	Exists(ctx context.Context, path string) (bool, error)
+
+	// GetURL 获取文件访问 URL
+	GetURL(path string) string
+}
+
+// CleanPath 规范化并校验存储路径
+// 返回使用 / 分隔、不以 / 开头、不包含 .. 的相对路径
+func CleanPath(p string) (string, error) {
+	if p == "" || strings.ContainsRune(p, 0) {
+		return "", ErrInvalidPath
+	}
+
+	// 统一分隔符，防止 Windows 风格路径绕过检查
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") {
+		return "", ErrInvalidPath
+	}
+
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == "" {
+		return "", ErrInvalidPath
+	}
+
+	return cleaned, nil
+}
+
+// cleanPrefix 规范化 List 使用的前缀
+// 空前缀合法，表示存储根
+func cleanPrefix(prefix string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	return CleanPath(strings.TrimSuffix(prefix, "/"))
+}
+
+// joinURL 拼接访问 URL
+func joinURL(baseURL, p string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + p
+}
@@ -0,0 +1,365 @@
+// Package storagetest 提供 storage.Storage 的一致性测试套件
+// 任何新的存储后端都应通过 Run 中的全部用例，用法:
+//
+//	func TestMyStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			return newMyStorage(t)
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"image-hosting/internal/storage"
+)
+
+// Factory 为每个用例创建一个全新的、空的存储实例
+type Factory func(t *testing.T) storage.Storage
+
+// Run 运行全部一致性测试
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"SaveAndOpen", testSaveAndOpen},
+		{"SaveOverwrites", testSaveOverwrites},
+		{"Stat", testStat},
+		{"Exists", testExists},
+		{"Delete", testDelete},
+		{"NotExist", testNotExist},
+		{"List", testList},
+		{"InvalidPath", testInvalidPath},
+		{"SaveReaderError", testSaveReaderError},
+		{"ConcurrentSave", testConcurrentSave},
+		{"GetURL", testGetURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+// save 保存文件，失败时终止用例
+func save(t *testing.T, s storage.Storage, path string, data []byte) string {
+	t.Helper()
+	url, err := s.Save(context.Background(), path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Save(%q) error: %v", path, err)
+	}
+	return url
+}
+
+// readAll 读取文件全部内容，失败时终止用例
+func readAll(t *testing.T, s storage.Storage, path string) []byte {
+	t.Helper()
+	rc, err := s.Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Open(%q) error: %v", path, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %q error: %v", path, err)
+	}
+	return data
+}
+
+func testSaveAndOpen(t *testing.T, s storage.Storage) {
+	data := []byte("hello storage")
+	url := save(t, s, "2024/12/a.webp", data)
+	if url == "" {
+		t.Errorf("Save returned empty URL")
+	}
+
+	if got := readAll(t, s, "2024/12/a.webp"); !bytes.Equal(got, data) {
+		t.Errorf("Open content = %q, want %q", got, data)
+	}
+}
+
+func testSaveOverwrites(t *testing.T, s storage.Storage) {
+	save(t, s, "x/over.webp", []byte("first version, longer"))
+	save(t, s, "x/over.webp", []byte("second"))
+
+	if got := readAll(t, s, "x/over.webp"); string(got) != "second" {
+		t.Errorf("content after overwrite = %q, want %q", got, "second")
+	}
+}
+
+func testStat(t *testing.T, s storage.Storage) {
+	data := bytes.Repeat([]byte{0xAB}, 1234)
+	save(t, s, "stat/file.bin", data)
+
+	info, err := s.Stat(context.Background(), "stat/file.bin")
+	if err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+	if info.Path != "stat/file.bin" {
+		t.Errorf("Stat Path = %q, want %q", info.Path, "stat/file.bin")
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Stat Size = %d, want %d", info.Size, len(data))
+	}
+	if info.ModTime.IsZero() {
+		t.Errorf("Stat ModTime is zero")
+	}
+}
+
+func testExists(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, "exists/yes.webp", []byte("y"))
+
+	ok, err := s.Exists(ctx, "exists/yes.webp")
+	if err != nil || !ok {
+		t.Errorf("Exists(existing) = %v, %v; want true, nil", ok, err)
+	}
+
+	ok, err = s.Exists(ctx, "exists/no.webp")
+	if err != nil || ok {
+		t.Errorf("Exists(missing) = %v, %v; want false, nil", ok, err)
+	}
+
+	// 目录本身不算文件
+	ok, err = s.Exists(ctx, "exists")
+	if err != nil || ok {
+		t.Errorf("Exists(directory) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, "del/a.webp", []byte("a"))
+	save(t, s, "del/b.webp", []byte("b"))
+
+	if err := s.Delete(ctx, "del/a.webp"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+
+	if ok, _ := s.Exists(ctx, "del/a.webp"); ok {
+		t.Errorf("file still exists after Delete")
+	}
+	if ok, _ := s.Exists(ctx, "del/b.webp"); !ok {
+		t.Errorf("Delete removed a sibling file")
+	}
+}
+
+func testNotExist(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.Open(ctx, "missing/file.webp"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Open(missing) error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.Stat(ctx, "missing/file.webp"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want ErrNotExist", err)
+	}
+	if err := s.Delete(ctx, "missing/file.webp"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Delete(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testList(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	paths := []string{"2024/11/c.webp", "2024/12/a.webp", "2024/12/b.webp", "2025/01/d.webp"}
+	for _, p := range paths {
+		save(t, s, p, []byte(p))
+	}
+
+	all, err := s.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List(\"\") error: %v", err)
+	}
+	// 后端可能在根目录放置自己的文件，只检查写入的文件都在且有序
+	if !containsInOrder(all, paths) {
+		t.Errorf("List(\"\") = %v, want to contain %v in order", fileNames(all), paths)
+	}
+
+	dec, err := s.List(ctx, "2024/12")
+	if err != nil {
+		t.Fatalf("List(2024/12) error: %v", err)
+	}
+	want := []string{"2024/12/a.webp", "2024/12/b.webp"}
+	if got := fileNames(dec); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List(2024/12) = %v, want %v", got, want)
+	}
+	for _, f := range dec {
+		if f.Size != int64(len(f.Path)) {
+			t.Errorf("List size of %s = %d, want %d", f.Path, f.Size, len(f.Path))
+		}
+	}
+
+	// 前缀按目录匹配，2024/1 不应匹配 2024/11 或 2024/12
+	partial, err := s.List(ctx, "2024/1")
+	if err != nil {
+		t.Fatalf("List(2024/1) error: %v", err)
+	}
+	if len(partial) != 0 {
+		t.Errorf("List(2024/1) = %v, want empty", fileNames(partial))
+	}
+
+	empty, err := s.List(ctx, "1999")
+	if err != nil {
+		t.Fatalf("List(missing dir) error: %v", err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("List(missing dir) = %v, want empty", fileNames(empty))
+	}
+}
+
+func testInvalidPath(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	invalid := []string{
+		"",
+		"/etc/passwd",
+		"../escape.webp",
+		"a/../../escape.webp",
+		"a/../b.webp",
+		"..\\escape.webp",
+		"nul\x00byte",
+	}
+
+	for _, p := range invalid {
+		if _, err := s.Save(ctx, p, strings.NewReader("x")); !errors.Is(err, storage.ErrInvalidPath) {
+			t.Errorf("Save(%q) error = %v, want ErrInvalidPath", p, err)
+		}
+		if _, err := s.Open(ctx, p); !errors.Is(err, storage.ErrInvalidPath) {
+			t.Errorf("Open(%q) error = %v, want ErrInvalidPath", p, err)
+		}
+		if _, err := s.Stat(ctx, p); !errors.Is(err, storage.ErrInvalidPath) {
+			t.Errorf("Stat(%q) error = %v, want ErrInvalidPath", p, err)
+		}
+		if err := s.Delete(ctx, p); !errors.Is(err, storage.ErrInvalidPath) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidPath", p, err)
+		}
+		if _, err := s.Exists(ctx, p); !errors.Is(err, storage.ErrInvalidPath) {
+			t.Errorf("Exists(%q) error = %v, want ErrInvalidPath", p, err)
+		}
+	}
+
+	if _, err := s.List(ctx, "../"); !errors.Is(err, storage.ErrInvalidPath) {
+		t.Errorf("List(../) error = %v, want ErrInvalidPath", err)
+	}
+}
+
+// failingReader 读取部分数据后返回错误
+type failingReader struct {
+	n int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("simulated read failure")
+	}
+	n := len(p)
+	if n > r.n {
+		n = r.n
+	}
+	for i := 0; i < n; i++ {
+		p[i] = 'z'
+	}
+	r.n -= n
+	return n, nil
+}
+
+func testSaveReaderError(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, "atomic/file.webp", []byte("original"))
+
+	// 写入中途失败时，旧文件必须保持完整
+	if _, err := s.Save(ctx, "atomic/file.webp", &failingReader{n: 100}); err == nil {
+		t.Fatalf("Save with failing reader succeeded, want error")
+	}
+	if got := readAll(t, s, "atomic/file.webp"); string(got) != "original" {
+		t.Errorf("content after failed Save = %q, want %q", got, "original")
+	}
+
+	// 不能留下半成品文件
+	files, err := s.List(ctx, "atomic")
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if got := fileNames(files); len(got) != 1 || got[0] != "atomic/file.webp" {
+		t.Errorf("List after failed Save = %v, want [atomic/file.webp]", got)
+	}
+
+	// 新文件写入失败时不应出现
+	if _, err := s.Save(ctx, "atomic/new.webp", &failingReader{n: 10}); err == nil {
+		t.Fatalf("Save with failing reader succeeded, want error")
+	}
+	if ok, _ := s.Exists(ctx, "atomic/new.webp"); ok {
+		t.Errorf("partially written file is visible")
+	}
+}
+
+func testConcurrentSave(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const workers = 8
+	payload := func(i int) []byte {
+		return bytes.Repeat([]byte{byte('a' + i)}, 64*1024)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := s.Save(ctx, "concurrent/same.bin", bytes.NewReader(payload(i))); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent Save error: %v", err)
+	}
+
+	// 最终内容必须是某一次完整写入，不能交错
+	got := readAll(t, s, "concurrent/same.bin")
+	for i := 0; i < workers; i++ {
+		if bytes.Equal(got, payload(i)) {
+			return
+		}
+	}
+	t.Errorf("content after concurrent Save is not any single writer's payload (len %d)", len(got))
+}
+
+func testGetURL(t *testing.T, s storage.Storage) {
+	url := save(t, s, "2024/12/url.webp", []byte("u"))
+	if got := s.GetURL("2024/12/url.webp"); got != url {
+		t.Errorf("GetURL = %q, want URL returned by Save %q", got, url)
+	}
+	if !strings.HasSuffix(url, "2024/12/url.webp") {
+		t.Errorf("URL %q does not end with storage path", url)
+	}
+}
+
+// fileNames 提取文件路径列表
+func fileNames(files []storage.FileInfo) []string {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Path)
+	}
+	return names
+}
+
+// containsInOrder 判断 files 是否按顺序包含 want 中的全部路径
+func containsInOrder(files []storage.FileInfo, want []string) bool {
+	i := 0
+	for _, f := range files {
+		if i < len(want) && f.Path == want[i] {
+			i++
+		}
+	}
+	return i == len(want)
+}
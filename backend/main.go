@@ -3,9 +3,14 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"image-hosting/internal/config"
 	"image-hosting/internal/handler"
@@ -16,8 +21,14 @@ import (
 func main() {
 	// 命令行参数
 	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	hashPassword := flag.Bool("hash-password", false, "从标准输入读取密码，输出 auth.users 中使用的 password_hash 后退出")
 	flag.Parse()
 
+	if *hashPassword {
+		printPasswordHash()
+		return
+	}
+
 	// 加载配置
 	cfg, err := config.Load(*configPath)
 	if err != nil {
@@ -27,6 +38,7 @@ func main() {
 	log.Printf("Starting image hosting server...")
 	log.Printf("Storage type: %s", cfg.Storage.Type)
 	log.Printf("Storage path: %s", cfg.Storage.BasePath)
+	log.Printf("Metadata type: %s", cfg.Metadata.Type)
 	log.Printf("Auth enabled: %v", cfg.Auth.Enabled)
 
 	// 初始化存储
@@ -37,18 +49,71 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create local storage: %v", err)
 		}
+	case "s3":
+		s3cfg := cfg.Storage.S3
+		log.Printf("S3 endpoint: %s, bucket: %s", s3cfg.Endpoint, s3cfg.Bucket)
+		store, err = storage.NewS3Storage(storage.S3Options{
+			Endpoint:        s3cfg.Endpoint,
+			Region:          s3cfg.Region,
+			Bucket:          s3cfg.Bucket,
+			AccessKeyID:     s3cfg.AccessKeyID,
+			SecretAccessKey: s3cfg.SecretAccessKey,
+			PathStyle:       s3cfg.PathStyle,
+			Prefix:          s3cfg.Prefix,
+			BaseURL:         cfg.Storage.BaseURL,
+			PartSize:        s3cfg.PartSize,
+			Timeout:         time.Duration(s3cfg.RequestTimeoutSecs) * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create s3 storage: %v", err)
+		}
 	default:
 		log.Fatalf("Unsupported storage type: %s", cfg.Storage.Type)
 	}
 
+	// 用户账号
+	accounts, err := service.NewAccountService(&cfg.Auth, &cfg.Quota.Default)
+	if err != nil {
+		log.Fatalf("Failed to load auth users: %v", err)
+	}
+	if cfg.Auth.Enabled {
+		log.Printf("Auth users: %d", len(cfg.Auth.Users))
+	}
+
 	// 初始化服务
-	imageService, err := service.NewImageService(cfg, store)
+	imageService, err := service.NewImageService(cfg, store, accounts)
 	if err != nil {
 		log.Fatalf("Failed to create image service: %v", err)
 	}
+	defer imageService.Close()
+
+	// 断点续传服务
+	var uploads *service.ResumableUploadService
+	if cfg.Tus.Enabled {
+		uploads, err = service.NewResumableUploadService(&cfg.Tus, cfg.Image.MaxSize, imageService)
+		if err != nil {
+			log.Fatalf("Failed to create resumable upload service: %v", err)
+		}
+		defer uploads.Close()
+		log.Printf("Resumable upload (tus) dir: %s", cfg.Tus.UploadDir)
+	}
+
+	// 异步处理服务
+	var jobs *service.JobService
+	if cfg.Jobs.Enabled {
+		jobs, err = service.NewJobService(&cfg.Jobs, imageService, handler.ErrorCode)
+		if err != nil {
+			log.Fatalf("Failed to create job service: %v", err)
+		}
+		defer jobs.Close()
+		log.Printf("Async job dir: %s", cfg.Jobs.Dir)
+	}
 
 	// 设置路由
-	router := handler.SetupRouter(cfg, store, imageService)
+	router := handler.SetupRouter(cfg, store, imageService, uploads, jobs, accounts)
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -58,3 +123,21 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// printPasswordHash 从标准输入读取一行密码并输出 bcrypt 哈希
+func printPasswordHash() {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatalf("Password is empty")
+	}
+
+	hash, err := service.HashPassword(password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
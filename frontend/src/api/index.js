@@ -111,6 +111,18 @@ export async function getImage(id) {
   return request(`/image/${id}`)
 }
 
+/**
+ * 获取私有图片的签名访问地址
+ * 私有图片的列表与详情中不包含访问地址，需通过签名地址显示
+ * @param {string} id - 图片 ID
+ * @param {number} expiresIn - 有效期 (秒)，不传时使用服务端默认值
+ * @returns {Promise<object>} - 签名地址 { url, expires_at, thumbnails }
+ */
+export async function getSignedUrl(id, expiresIn) {
+  const query = expiresIn ? `?expires_in=${expiresIn}` : ''
+  return request(`/image/${id}/signed-url${query}`)
+}
+
 /**
  * 删除图片
  * @param {string} id - 图片 ID
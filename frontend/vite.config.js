@@ -14,6 +14,11 @@ export default defineConfig({
       '/images': {
         target: 'http://localhost:8080',
         changeOrigin: true
+      },
+      // 私有图片签名地址
+      '/private': {
+        target: 'http://localhost:8080',
+        changeOrigin: true
       }
     }
   }